@@ -7,7 +7,10 @@ require (
 	github.com/lib/pq v1.8.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/speps/go-hashids v2.0.0+incompatible
+	github.com/spf13/cast v1.3.0
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.3.0
+	gopkg.in/yaml.v2 v2.2.8
 )
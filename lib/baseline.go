@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+/*
+ * Baseline writes a migration reproducing the schema of a database that was
+ * created without goose into a new directory in directory, and records it in
+ * a new goosey table as applied.  The migration has no hash until it is
+ * committed, so it is recorded by its directory and resolveBaselines fills in
+ * the hash later.
+ */
+func Baseline(db *DB, directory string) (string, error) {
+	exists, err := db.HasGoosey()
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("goose already keeps track of this database in %s", db.Table)
+	}
+
+	schema, err := db.DumpSchema()
+	if err != nil {
+		return "", err
+	}
+	path, err := writeBaseline(directory, "goose_baseline_adopted", schema, Metadata{
+		Description: "Baseline of the schema the database had when goose adopted it",
+		Tags:        []string{"baseline"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.EnsureGoosey(); err != nil {
+		return path, err
+	}
+	// like the starting hash of init, the empty batch keeps goose from
+	// rolling back past the baseline
+	if _, err = db.Exec(fmt.Sprintf(`
+		INSERT INTO %s (hash, batch, path) VALUES ('', '', $1)
+	`, db.Table), filepath.Base(path)); err != nil {
+		return path, err
+	}
+	return path, db.recordHistory(context.Background(), db.DB, "", actionBaseline, "")
+}
+
+/*
+ * resolveBaselines fills in the hash of goosey rows that were recorded by
+ * directory once the directory is committed.  It fails while a recorded
+ * directory isn't committed yet, because goose can't tell what is pending
+ * without it.  Only commands that change goosey resolve baselines.
+ */
+func resolveBaselines(db *DB, migrations Migrations) error {
+	unresolved, err := unresolvedBaselines(db)
+	if err != nil {
+		return err
+	}
+	for id, path := range unresolved {
+		migration, err := migrations.Find(path)
+		if err != nil {
+			return fmt.Errorf("commit the baseline %s before running goose: %s", path, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf(`
+			UPDATE %s SET hash = $1 WHERE id = $2
+		`, db.Table), migration.Hash, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * checkBaselines fails while goosey has baselines without a hash, for
+ * commands that only read goosey.
+ */
+func checkBaselines(db *DB) error {
+	unresolved, err := unresolvedBaselines(db)
+	if err != nil {
+		return err
+	}
+	for _, path := range unresolved {
+		return fmt.Errorf("the baseline %s has no hash in goosey yet, commit it and run goose up", path)
+	}
+	return nil
+}
+
+/*
+ * unresolvedBaselines returns the directories of the goosey rows without a
+ * hash by their id.
+ */
+func unresolvedBaselines(db *DB) (map[int]string, error) {
+	if exists, err := db.HasGoosey(); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, path FROM %s WHERE hash = '' AND path IS NOT NULL
+	`, db.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unresolved := map[int]string{}
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		unresolved[id] = path
+	}
+	return unresolved, rows.Err()
+}
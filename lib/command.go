@@ -1,18 +1,22 @@
 package lib
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -28,47 +32,151 @@ var (
 )
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRunE = initDependancies
 	cobra.EnableCommandSorting = false
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(makeCmd)
 	rootCmd.AddCommand(upCmd)
 	rootCmd.AddCommand(downCmd)
 	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(batchesCmd)
+	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(rollbackCmd)
 	rootCmd.AddCommand(redoCmd)
+	rootCmd.AddCommand(envCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(lintCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(dumpCmd)
+	rootCmd.AddCommand(driftCmd)
+	rootCmd.AddCommand(squashCmd)
+	rootCmd.AddCommand(baselineCmd)
+	rootCmd.AddCommand(markCmd)
+	rootCmd.AddCommand(templatesCmd)
 
 	listCmd.AddCommand(listExecutedCmd)
 	listCmd.AddCommand(listPendingCmd)
 
-	makeCmd.Flags().StringVarP(&templateType, "template", "t", "schema", `The template to use to make your migration scripts. These templates are defined in the .goose.yaml file.`)
+	envCmd.AddCommand(envListCmd)
+	configCmd.AddCommand(configShowCmd)
+	testCmd.AddCommand(roundtripCmd)
+	markCmd.AddCommand(markAppliedCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	markCmd.AddCommand(markPendingCmd)
+
+	rootCmd.PersistentFlags().StringVar(&environment, "env", "", `The environment from .goose.yaml to use. Defaults to GOOSE_ENV and then default_env.`)
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, `The output format, json or text. json turns colors off.`)
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", `A config file that overrides the repository and user .goose.yaml files.`)
+	rootCmd.PersistentFlags().String("database-url", "", `The database to migrate, overriding the config files and GOOSE_DATABASE_URL.`)
+	rootCmd.PersistentFlags().String("repo", "", `The migration repository, overriding the config files and GOOSE_MIGRATION_REPOSITORY.`)
+
+	initCmd.Flags().StringVar(&initAt, "at", "", "Start at the last migration merged by this date (2006-01-02 or RFC 3339)")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Drop an existing goosey table after confirmation and initialize again")
+
+	upCmd.Flags().StringVar(&targetsFile, "targets", "", "A yaml file with a list of targets to migrate instead of the configured database")
+	upCmd.Flags().IntVar(&concurrency, "concurrency", 4, "The number of targets or schemas migrated at the same time")
+	upCmd.Flags().BoolVar(&allSchemas, "all-schemas", false, "Migrate every tenant schema found with the tenants settings")
+	statusCmd.Flags().BoolVar(&allSchemas, "all-schemas", false, "Show how far behind every tenant schema is")
+	statusCmd.Flags().IntVar(&concurrency, "concurrency", 4, "The number of schemas checked at the same time")
+	upCmd.Flags().BoolVar(&ignoreDrift, "ignore-drift", false, "Migrate even if the schema was changed outside of migrations")
+	upCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the rendered scripts instead of running them")
+	downCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the rendered scripts instead of running them")
+	upCmd.Flags().StringSlice("tags", nil, "Only apply migrations with one of these tags")
+	upCmd.Flags().StringSlice("exclude-tags", nil, "Skip migrations with any of these tags")
+	viper.BindPFlag("tags", upCmd.Flags().Lookup("tags"))
+	viper.BindPFlag("exclude-tags", upCmd.Flags().Lookup("exclude-tags"))
+
+	lintCmd.Flags().BoolVar(&lintAll, "all", false, "Lint every migration instead of the pending ones")
+	rootCmd.PersistentFlags().String("scratch-url", "", "A scratch database goose may change freely, overriding scratch.database-url")
+	viper.BindPFlag("scratch.database-url", rootCmd.PersistentFlags().Lookup("scratch-url"))
+	roundtripCmd.Flags().String("template", "", "Create a new scratch database from this template database and drop it afterwards")
+	viper.BindPFlag("scratch.template", roundtripCmd.Flags().Lookup("template"))
+	makeCmd.Flags().StringVar(&desiredSchema, "diff", "", "A file with the desired schema to generate the up and down scripts from")
+	dumpCmd.Flags().StringVarP(&dumpFile, "file", "f", "", "Write the snapshot to this file instead of stdout")
+	squashCmd.Flags().StringVar(&squashBefore, "before", "", "Squash the migrations before this migration, hash prefix or date (2006-01-02)")
+	squashCmd.MarkFlagRequired("before")
+	markCmd.PersistentFlags().StringVar(&markReason, "reason", "", "Why the migration is marked, kept in the history table")
+	markCmd.MarkPersistentFlagRequired("reason")
+
+	makeCmd.Flags().StringVarP(&templateType, "template", "t", "schema", `The template to use to make your migration scripts, from .goose.yaml or the templates directory of the migration repository.`)
+	makeCmd.Flags().StringVar(&makeAuthor, "author", "", `The author of the migration, "Name <email>", instead of git's user.name and user.email`)
+	makeCmd.Flags().StringArrayVar(&makeVars, "var", nil, "A key=value variable for the template, used as {{ .Vars.key }}")
 }
 
-func initConfig() {
-	viper.AddConfigPath("$HOME/")
-	viper.AddConfigPath(".")
-	viper.SetConfigName(".goose")
-	viper.SetConfigType("yaml")
-	err := viper.ReadInConfig()
-	if err != nil {
-		panic(fmt.Errorf("fatal error config file: %s", err))
-	}
+const needsAnnotation = "needs"
 
-	initDependancies()
+// the dependencies a command can declare with needs
+const (
+	needConfig     = "config"
+	needDatabase   = "database"
+	needMigrations = "migrations"
+
+	// needWrite marks commands that change goosey
+	needWrite = "write"
+)
+
+/*
+ * needs declares what a command depends on.  Commands that need nothing, like
+ * help and completion, don't read the config, connect to the database or scan
+ * the git history.
+ */
+func needs(dependencies ...string) map[string]string {
+	return map[string]string{needsAnnotation: strings.Join(dependencies, ",")}
 }
 
-func initDependancies() {
-	var err error
-	db, err = NewDatabase()
-	if err != nil {
-		log.Fatal(err)
+/*
+ * initDependancies loads what the command being run declared with needs.
+ */
+func initDependancies(cmd *cobra.Command, args []string) error {
+	if err := initOutput(); err != nil {
+		return err
 	}
 
-	migrations = NewMigrations()
+	declared := cmd.Annotations[needsAnnotation]
+	if declared == "" {
+		return nil
+	}
+
+	// the usage doesn't help with a missing config or database
+	cmd.SilenceUsage = true
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	var err error
+	writes := false
+	for _, dependency := range strings.Split(declared, ",") {
+		switch dependency {
+		case needDatabase:
+			db, err = NewDatabase()
+		case needMigrations:
+			migrations, err = NewMigrations()
+		case needWrite:
+			writes = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if db != nil && migrations != nil {
+		if writes && !dryRun {
+			return resolveBaselines(db, migrations)
+		}
+		return checkBaselines(db)
+	}
+	return nil
 }
 
 // Execute will run cobra cli
 func Execute() error {
+	// passwords must not end up in logs or error messages
+	log.SetOutput(maskWriter{os.Stderr})
+	color.Output = maskWriter{color.Output}
+	rootCmd.SetErr(maskWriter{os.Stderr})
 	return rootCmd.Execute()
 }
 
@@ -85,71 +193,297 @@ func stepValidator(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+/*
+ * appliedMigrations returns the migrations of all that come before the pending
+ * ones in the database, leaving out the ones that were skipped.
+ */
+func appliedMigrations(db *DB, all Migrations) (Migrations, error) {
+	instructions := NewInstructions(pending)
+	err := db.LastBatch(instructions)
+	if err != nil && err.Error() != "sql: no rows in result set" {
+		return nil, err
+	}
+
+	remaining := append(Migrations{}, all...)
+	sort.Sort(remaining)
+	if err := remaining.Slice(instructions); err != nil {
+		return nil, err
+	}
+
+	skipped, err := all.Skipped(db)
+	if err != nil {
+		return nil, err
+	}
+
+	isPending := make(map[*Migration]bool, len(remaining))
+	for _, m := range append(remaining, skipped...) {
+		isPending[m] = true
+	}
+
+	applied := Migrations{}
+	for _, m := range all {
+		if !isPending[m] {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+/*
+ * pendingMigrations returns the migrations of all that haven't been applied
+ * to db, including the ones that were skipped.
+ */
+func pendingMigrations(db *DB, all Migrations) (Migrations, error) {
+	if err := checkBaselines(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db, all)
+	if err != nil {
+		return nil, err
+	}
+	isApplied := make(map[*Migration]bool, len(applied))
+	for _, migration := range applied {
+		isApplied[migration] = true
+	}
+
+	pending := Migrations{}
+	for _, migration := range all {
+		if !isApplied[migration] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+var (
+	initAt    string
+	initForce bool
+)
+
 var initCmd = &cobra.Command{
-	Use:   "init [commit hash]",
+	Use:   "init [migration|latest]",
 	Short: "Initializes a migration table in the database called goosey",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Initializes a migration table in the database called goosey.  With a
+starting point, a migration directory, hash prefix, latest or --at a date,
+that migration and every migration before it count as applied.`,
+	Annotations: needs(needDatabase, needMigrations),
+	Args:        cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		start, err := initStart(args)
+		if err != nil {
+			return err
+		}
 
-		start := ""
-		if len(args) == 1 {
-			start = args[0]
+		exists, err := db.HasGoosey()
+		if err != nil {
+			return err
+		}
+		if exists && !initForce {
+			fmt.Printf("goose is already initialized in %s, use --force to start over\n", db.Table)
+			return nil
+		}
+		if exists && !confirm(fmt.Sprintf(
+			"drop %s and forget every applied migration?", db.Table)) {
+			return errors.New("not reinitialized")
 		}
 
-		if err := db.InitGoosey(start); err != nil {
+		if err := db.InitGoosey(start, exists); err != nil {
 			return err
 		}
-		fmt.Println("initialized successfully")
+		if start != nil {
+			fmt.Printf("initialized successfully at %s %s\n", start.Hash, start.Path)
+		} else {
+			fmt.Println("initialized successfully")
+		}
 		return nil
 	},
 }
 
+/*
+ * initStart returns the migration init starts at, or nil to start before the
+ * first migration.
+ */
+func initStart(args []string) (*Migration, error) {
+	if initAt != "" {
+		if len(args) > 0 {
+			return nil, errors.New("give either a starting migration or --at")
+		}
+		date, ok := parseDate(initAt)
+		if !ok {
+			return nil, fmt.Errorf("invalid date %s, use 2006-01-02 or RFC 3339", initAt)
+		}
+		// a day includes the migrations merged during it
+		if _, err := time.Parse("2006-01-02", initAt); err == nil {
+			date = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		var start *Migration
+		for _, migration := range migrations {
+			if migration.MergedDate.After(date) {
+				break
+			}
+			start = migration
+		}
+		if start == nil {
+			return nil, fmt.Errorf("no migration was merged by %s", initAt)
+		}
+		return start, nil
+	}
+
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if args[0] == "latest" {
+		if len(migrations) == 0 {
+			return nil, errors.New("there are no migrations")
+		}
+		return migrations[len(migrations)-1], nil
+	}
+	return migrations.Find(args[0])
+}
+
 var upCmd = &cobra.Command{
 	Use:   "up [steps]",
 	Short: "Run one or more up migrations",
+	// the database is opened by RunE because with targets there are many
+	Annotations: needs(needMigrations),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		instructions := NewInstructions(up, args...)
-		err = db.LastBatch(instructions)
-		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+		targets, err := loadTargets()
+		if err != nil {
+			return err
+		}
+		if len(targets) > 0 && allSchemas {
+			return errors.New("--all-schemas can not be used with targets, list the schemas as targets instead")
 		}
 
-		if err := migrations.Slice(instructions); err != nil {
-			if err.Error() == "no marker" {
-				return nil
+		if len(targets) == 0 {
+			if db, err = NewDatabase(); err != nil {
+				return err
+			}
+			if !allSchemas {
+				results, err := migrateUp(db, migrations, args)
+				return reportRun("up", results, afterRun(db, results, err))
+			}
+			if targets, err = tenantTargets(db); err != nil {
+				return err
 			}
-			return err
 		}
 
-		if err := migrations.Execute(instructions); err != nil {
+		results := runTargets(targets, concurrency, func(db *DB, result *TargetResult) error {
+			// a dry run treats a schema without goosey as empty
+			if allSchemas && !dryRun {
+				if err := db.EnsureGoosey(); err != nil {
+					return err
+				}
+			}
+			var err error
+			result.Migrations, err = migrateUp(db, migrations, args)
+			result.Count = len(result.Migrations)
+			// targets share the snapshot file, so only the fingerprint is recorded
+			if !dryRun && (err == nil || ranScripts(result.Migrations)) {
+				if _, recordErr := recordFingerprint(db); err == nil {
+					err = recordErr
+				}
+			}
 			return err
-		}
-		return nil
+		})
+		return printTargetResults("up", results)
 	},
 	Args: stepValidator,
 }
 
+// dryRun is set by --dry-run
+var dryRun bool
+
+/*
+ * migrateUp applies the pending migrations of all to db and returns what
+ * happened to each of them.
+ */
+func migrateUp(db *DB, all Migrations, args []string) ([]MigrationResult, error) {
+	instructions := NewInstructions(up, args...)
+	instructions.DryRun = dryRun
+	instructions.Tags = viper.GetStringSlice("tags")
+	instructions.ExcludeTags = viper.GetStringSlice("exclude-tags")
+
+	if dryRun {
+		exists, err := db.HasGoosey()
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			// nothing is applied to a database without goosey
+			pending := append(Migrations{}, all...)
+			if err := pending.Slice(instructions); err != nil {
+				return nil, err
+			}
+			return pending.Execute(db, instructions)
+		}
+		if err := checkBaselines(db); err != nil {
+			return nil, err
+		}
+	} else if err := resolveBaselines(db, all); err != nil {
+		return nil, err
+	}
+	if err := checkDrift(db); err != nil {
+		return nil, err
+	}
+
+	err := db.LastBatch(instructions)
+	if err != nil && err.Error() != "sql: no rows in result set" {
+		return nil, err
+	}
+
+	// migrations skipped by earlier runs come before everything else that
+	// is pending, so they run first if they match this time
+	skipped, err := all.Skipped(db)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := append(Migrations{}, all...)
+	if err := pending.Slice(instructions); err != nil {
+		if err.Error() == "no marker" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pending = append(skipped, pending...)
+
+	return pending.Execute(db, instructions)
+}
+
 var downCmd = &cobra.Command{
-	Use:   "down [steps]",
-	Short: "Run one or more down migrations",
+	Use:         "down [steps]",
+	Short:       "Run one or more down migrations",
+	Annotations: needs(needDatabase, needMigrations, needWrite),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instructions := NewInstructions(down, args...)
+		instructions.DryRun = dryRun
 		err = db.LastBatch(instructions)
 		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+			return err
+		}
+
+		applied, err := appliedMigrations(db, migrations)
+		if err != nil {
+			return err
 		}
 
 		if err := migrations.Slice(instructions); err != nil {
 			if err.Error() == "no marker" {
-				return nil
+				return reportRun("down", nil, nil)
 			}
 			return err
 		}
 
-		if err := migrations.Execute(instructions); err != nil {
+		if err := CheckRollback(applied, migrations); err != nil {
 			return err
 		}
-		return nil
+		if !dryRun && !confirmProtected(len(migrations)) {
+			return reportRun("down", nil, errors.New("not rolled back"))
+		}
+
+		results, err := migrations.Execute(db, instructions)
+		return reportRun("down", results, afterRun(db, results, err))
 	},
 	Args: stepValidator,
 }
@@ -160,174 +494,809 @@ var listCmd = &cobra.Command{
 }
 
 var listExecutedCmd = &cobra.Command{
-	Use:   "executed",
-	Short: "List all executed migrations",
+	Use:         "executed",
+	Short:       "List all executed migrations",
+	Annotations: needs(needDatabase, needMigrations),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instructions = NewInstructions(executed, []string{"10"}...)
 		err = db.LastBatch(instructions)
 		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+			return err
 		}
 
 		if err := migrations.Slice(instructions); err != nil {
 			if err.Error() == "no marker" {
-				return nil
+				return printMigrations(Migrations{})
 			}
 			return err
 		}
 
-		for _, d := range migrations {
-			fmt.Println(d.Hash, d.Path)
-		}
-		return nil
+		return printMigrations(migrations)
 	},
 }
 
 var listPendingCmd = &cobra.Command{
-	Use:   "pending",
-	Short: "List all pending migrations",
+	Use:         "pending",
+	Short:       "List all pending migrations",
+	Annotations: needs(needDatabase, needMigrations),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instructions = NewInstructions(pending)
 		err = db.LastBatch(instructions)
 		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+			return err
 		}
 
 		if err := migrations.Slice(instructions); err != nil {
 			if err.Error() == "no marker" {
-				return nil
+				return printMigrations(Migrations{})
 			}
 			return err
 		}
 
-		for _, d := range migrations {
-			fmt.Println(d.Hash, d.Path)
+		return printMigrations(migrations)
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:         "status",
+	Short:       "Show every migration and whether it has been applied",
+	Annotations: needs(needDatabase, needMigrations),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if allSchemas {
+			targets, err := tenantTargets(db)
+			if err != nil {
+				return err
+			}
+			results := runTargets(targets, concurrency, func(db *DB, result *TargetResult) error {
+				result.Count = len(migrations)
+				if exists, err := db.HasGoosey(); err != nil || !exists {
+					return err
+				}
+				applied, err := appliedMigrations(db, migrations)
+				result.Count -= len(applied)
+				return err
+			})
+			return printTenantStatus(results)
+		}
+
+		applied, err := appliedMigrations(db, migrations)
+		if err != nil {
+			return err
+		}
+
+		isApplied := make(map[*Migration]bool, len(applied))
+		for _, m := range applied {
+			isApplied[m] = true
+		}
+
+		skipped, err := migrations.Skipped(db)
+		if err != nil {
+			return err
+		}
+		isSkipped := make(map[*Migration]bool, len(skipped))
+		for _, m := range skipped {
+			isSkipped[m] = true
+		}
+
+		documents := []MigrationDocument{}
+		for _, m := range migrations {
+			state := "pending"
+			if isApplied[m] {
+				state = "applied"
+			} else if isSkipped[m] {
+				state = "skipped"
+			}
+			if jsonOutput() {
+				documents = append(documents, newMigrationDocument(m, state))
+				continue
+			}
+
+			switch state {
+			case "applied":
+				green("%-8s", state)
+			case "skipped":
+				cyan("%-8s", state)
+			default:
+				yellow("%-8s", state)
+			}
+			fmt.Printf(" %s %s", m.Hash, m.Path)
+			if len(m.Metadata.Tags) > 0 {
+				fmt.Printf(" [%s]", strings.Join(m.Metadata.Tags, ", "))
+			}
+			if m.Metadata.Description != "" {
+				fmt.Printf(" %s", m.Metadata.Description)
+			}
+			fmt.Println()
+		}
+
+		if jsonOutput() {
+			return printJSON(documents)
+		}
+		return nil
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:         "show {migration}",
+	Short:       "Show the details of a migration by directory name or hash prefix",
+	Annotations: needs(needMigrations),
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := migrations.Find(args[0])
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON(newMigrationDocument(m, ""))
+		}
+
+		fmt.Printf("%-13s %s\n", "path:", m.Path)
+		fmt.Printf("%-13s %s\n", "hash:", m.Hash)
+		fmt.Printf("%-13s %s\n", "author:", m.Up.Author)
+		fmt.Printf("%-13s %s\n", "created:", m.Up.CreateDate.Format(time.RFC3339))
+		fmt.Printf("%-13s %s\n", "merged:", m.MergedDate.Format(time.RFC3339))
+
+		metadata := m.Metadata
+		fmt.Printf("%-13s %s\n", "description:", metadata.Description)
+		fmt.Printf("%-13s %s\n", "ticket:", metadata.Ticket)
+		fmt.Printf("%-13s %s\n", "tags:", strings.Join(metadata.Tags, ", "))
+		fmt.Printf("%-13s %s\n", "lock timeout:", metadata.Timeouts.Lock)
+		fmt.Printf("%-13s %s\n", "stmt timeout:", metadata.Timeouts.Statement)
+		fmt.Printf("%-13s %s\n", "transaction:", metadata.Transaction)
+		fmt.Printf("%-13s %s\n", "depends on:", strings.Join(metadata.DependsOn, ", "))
+		fmt.Printf("%-13s %t\n", "irreversible:", metadata.Irreversible)
+		return nil
+	},
+}
+
+var batchesCmd = &cobra.Command{
+	Use:         "batches",
+	Short:       "List the batches of executed migrations",
+	Annotations: needs(needDatabase),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := db.Records()
+		if err != nil {
+			return err
+		}
+
+		batches := groupBatches(records)
+		if jsonOutput() {
+			return printJSON(batches)
+		}
+		for _, batch := range batches {
+			fmt.Printf("%-8s %3d  %s\n",
+				batch.Batch, len(batch.Hashes), batch.ExecutedAt.Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:         "history",
+	Short:       "List every change made to goosey in the order it was made",
+	Annotations: needs(needDatabase),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := db.HistoryEntries()
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput() {
+			return printJSON(entries)
+		}
+		for _, e := range entries {
+			fmt.Printf("%4d %s %-12s %-8s %s %s %s",
+				e.ID, e.RecordedAt.Format(time.RFC3339), e.Action, e.Batch, e.Hash, e.Path, e.RecordedBy)
+			if e.Reason != "" {
+				cyan("  # %s", e.Reason)
+			}
+			fmt.Println()
 		}
 		return nil
 	},
 }
 
 var redoCmd = &cobra.Command{
-	Use:   "redo",
-	Short: "Rollback to the last marker and reapply to the current marker",
+	Use:         "redo",
+	Short:       "Rollback to the last marker and reapply to the current marker",
+	Annotations: needs(needDatabase, needMigrations, needWrite),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		instructions := NewInstructions(redo)
 		err = db.LastBatch(instructions)
 		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+			return err
 		}
 		sort.Sort(sort.Reverse(migrations))
 
-		if err := migrations.Slice(instructions); err != nil {
-			if err.Error() == "no marker" {
-				return nil
-			}
+		applied, err := appliedMigrations(db, migrations)
+		if err != nil {
 			return err
 		}
 
-		if err := migrations.Execute(instructions); err != nil {
+		records, err := db.RecordsByHash()
+		if err != nil {
 			return err
 		}
+		migrations = migrations.InBatch(records, instructions.BatchHash)
+		if len(migrations) == 0 {
+			return reportRun("redo", nil, nil)
+		}
+
+		if err := CheckRollback(applied, migrations); err != nil {
+			return err
+		}
+		if !confirmProtected(len(migrations)) {
+			return reportRun("redo", nil, errors.New("not rolled back"))
+		}
+
+		results, err := migrations.Execute(db, instructions)
+		if err != nil {
+			return reportRun("redo", results, afterRun(db, results, err))
+		}
 
 		sort.Sort(migrations)
 		instructions.Direction = Up
 
-		if err := migrations.Execute(instructions); err != nil {
-			return err
-		}
-		return nil
+		reapplied, err := migrations.Execute(db, instructions)
+		results = append(results, reapplied...)
+		return reportRun("redo", results, afterRun(db, results, err))
 	},
 }
 
 var rollbackCmd = &cobra.Command{
-	Use:   "rollback",
-	Short: "Rollback to the last marker",
+	Use:         "rollback",
+	Short:       "Rollback to the last marker",
+	Annotations: needs(needDatabase, needMigrations, needWrite),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instructions = NewInstructions(rollback)
 		err = db.LastBatch(instructions)
 		if err != nil && err.Error() != "sql: no rows in result set" {
-			log.Fatal(err)
+			return err
 		}
 		sort.Sort(sort.Reverse(migrations))
 
-		if err := migrations.Slice(instructions); err != nil {
-			if err.Error() == "no marker" {
-				return nil
-			}
+		applied, err := appliedMigrations(db, migrations)
+		if err != nil {
+			return err
 		}
 
-		if err := migrations.Execute(instructions); err != nil {
+		records, err := db.RecordsByHash()
+		if err != nil {
 			return err
 		}
-		return nil
+		migrations = migrations.InBatch(records, instructions.BatchHash)
+		if len(migrations) == 0 {
+			return reportRun("rollback", nil, nil)
+		}
+
+		if err := CheckRollback(applied, migrations); err != nil {
+			return err
+		}
+		if !confirmProtected(len(migrations)) {
+			return reportRun("rollback", nil, errors.New("not rolled back"))
+		}
+
+		results, err := migrations.Execute(db, instructions)
+		return reportRun("rollback", results, afterRun(db, results, err))
 	},
 }
 
-type Values struct {
-	Migration string
-	Author    string
-	Directory string
-	Timestamp string
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Work with the environments in .goose.yaml",
+}
+
+var envListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List the configured environments",
+	Annotations: needs(needConfig),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selected := environmentName()
+		if jsonOutput() {
+			return printJSON(environmentDocuments(selected))
+		}
+		for _, env := range environments() {
+			marker := " "
+			if env.Name == selected {
+				marker = "*"
+			}
+			fmt.Printf("%s %s", marker, env.Name)
+			for _, key := range []string{"database-url", "schema", "table"} {
+				if value, ok := env.Settings[key]; ok {
+					fmt.Printf(" %s=%s", key, redactURL(fmt.Sprint(value)))
+				}
+			}
+			if protected, ok := env.Settings["protected"]; ok {
+				fmt.Printf(" protected=%v", protected)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
 }
 
-var templateType string
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the goose configuration",
+}
 
-var makeCmd = &cobra.Command{
-	Use:   "make {first_name} {last_name} {message}",
-	Short: "Make a new migration",
+var configShowCmd = &cobra.Command{
+	Use:         "show",
+	Short:       "Print the effective configuration and where each value came from",
+	Annotations: needs(needConfig),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if jsonOutput() {
+			return printJSON(effectiveConfig(cmd.Flags()))
+		}
+		for _, setting := range effectiveConfig(cmd.Flags()) {
+			fmt.Printf("%s = %s", setting.Key, setting.Value)
+			cyan("  # %s\n", setting.Source)
+		}
+		return nil
+	},
+}
 
-		now := time.Now()
-		timestamp := now.Format("20060102_150405")
-		migration := fmt.Sprintf("%s_%s_%s_%s",
-			timestamp, args[0], args[1], args[2])
-		directory := filepath.Join(
+var validateCmd = &cobra.Command{
+	Use:         "validate",
+	Short:       "Check the migration repository for mistakes without touching the database",
+	Annotations: needs(needConfig),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		problems, err := Validate(
 			viper.GetString("migration-repository"),
 			viper.GetString("migration-directory"),
-			migration,
 		)
-		fmt.Println(directory)
-		author := fmt.Sprintf("%s %s", args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput() {
+			if err := printJSON(problems); err != nil {
+				return err
+			}
+		} else {
+			for _, problem := range problems {
+				red("%s\n", problem)
+			}
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problems", len(problems))
+		}
+		return nil
+	},
+}
+
+var lintAll bool
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [migration...]",
+	Short: "Check migration scripts for risky statements",
+	Long: `Check migration scripts for risky statements.  Without arguments the pending
+migrations are checked.  Arguments are migration paths, names or hash prefixes,
+or directories of migrations that aren't committed yet.`,
+	// the database is only opened by RunE to find the pending migrations
+	Annotations: needs(needMigrations),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dirs := []string{}
+		switch {
+		case len(args) > 0:
+			for _, arg := range args {
+				if _, err := os.Stat(filepath.Join(arg, "up.sql")); err == nil {
+					dirs = append(dirs, arg)
+					continue
+				}
+				migration, err := migrations.Find(arg)
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, filepath.Dir(migration.Up.Path))
+			}
+
+		case lintAll:
+			for _, migration := range migrations {
+				dirs = append(dirs, filepath.Dir(migration.Up.Path))
+			}
+
+		default:
+			if db, err = NewDatabase(); err != nil {
+				return err
+			}
+			pending, err := pendingMigrations(db, migrations)
+			if err != nil {
+				return err
+			}
+			for _, migration := range pending {
+				dirs = append(dirs, filepath.Dir(migration.Up.Path))
+			}
+		}
+
+		findings, err := Lint(dirs)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput() {
+			if err := printJSON(findings); err != nil {
+				return err
+			}
+		} else {
+			for _, finding := range findings {
+				yellow("%s\n", finding)
+			}
+		}
+		if len(findings) > 0 {
+			return fmt.Errorf("found %d risky statements", len(findings))
+		}
+		return nil
+	},
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Test migrations against a scratch database",
+}
+
+var roundtripCmd = &cobra.Command{
+	Use:   "roundtrip",
+	Short: "Check that every pending migration's down script undoes its up script",
+	Long: `Check that every pending migration's down script undoes its up script.  Each
+pending migration is run up, down and up again on a scratch database and the
+schema read from the catalog is compared after every step.  The scratch
+database is changed, never point this at a database you care about.`,
+	// the scratch database is opened by RunE, the configured one is never used
+	Annotations: needs(needMigrations),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scratch, cleanup, err := openScratch(scratchSetting("template"))
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		if err := scratch.EnsureGoosey(); err != nil {
+			return err
+		}
+		pending, err := pendingMigrations(scratch, migrations)
+		if err != nil {
+			return err
+		}
+		return printRoundtripResults(pending.Roundtrip(scratch))
+	},
+}
+
+var dumpFile string
+
+var dumpCmd = &cobra.Command{
+	Use:         "dump",
+	Short:       "Print a snapshot of the database schema",
+	Long:        `Print the same schema snapshot that is written to the snapshot file after every run.`,
+	Annotations: needs(needDatabase),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := db.DumpSchema()
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON(schema)
+		}
+		if dumpFile != "" {
+			return ioutil.WriteFile(dumpFile, []byte(snapshotHeader+schema.String()), 0644)
+		}
+		fmt.Print(snapshotHeader + schema.String())
+		return nil
+	},
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "List schema changes made outside of migrations",
+	Long: `Compare the schema of the database with the schema recorded at the end of
+the last batch and list the objects that were added, removed or altered since.`,
+	Annotations: needs(needDatabase),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		changes, ok, err := db.Drift()
+		if err != nil {
+			return err
+		}
+		return printDrift(changes, ok)
+	},
+}
+
+var squashBefore string
+
+var squashCmd = &cobra.Command{
+	Use:   "squash",
+	Short: "Squash old migrations into a single baseline migration",
+	Long: `Squash old migrations into a single baseline migration.  The migrations
+before --before are applied to an empty scratch database and its schema is
+written as a new baseline migration.  Databases that applied every squashed
+migration treat the baseline as applied, new databases run the baseline
+instead of the squashed migrations.  Commit the baseline, after that the
+squashed directories can be deleted.`,
+	Annotations: needs(needMigrations),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		squashed, err := migrationsBefore(migrations, squashBefore)
+		if err != nil {
+			return err
+		}
+		if len(squashed) == 0 {
+			return fmt.Errorf("no migrations before %s", squashBefore)
+		}
 
-		templates := viper.GetStringMap(
-			"templates")[templateType].(map[string]interface{})
+		path, err := Squash(squashed, filepath.Join(
+			viper.GetString("migration-repository"),
+			viper.GetString("migration-directory"),
+		))
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
 
-		if err := os.Mkdir(directory, 0777); err != nil {
+var baselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "Adopt a database that was created without goose",
+	Long: `Adopt a database that was created without goose.  The schema of the
+database is written as a new baseline migration and goosey is created with the
+baseline recorded as applied.  Commit the baseline before running goose again.`,
+	Annotations: needs(needDatabase),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := Baseline(db, filepath.Join(
+			viper.GetString("migration-repository"),
+			viper.GetString("migration-directory"),
+		))
+		if err != nil {
 			return err
 		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+var markReason string
+
+var markCmd = &cobra.Command{
+	Use:   "mark",
+	Short: "Mark a migration applied or pending without running it",
+}
 
-		values := Values{
-			Migration: migration,
-			Author:    author,
-			Directory: directory,
-			Timestamp: timestamp,
+var markAppliedCmd = &cobra.Command{
+	Use:   "applied {migration}",
+	Short: "Record a migration as applied without running its up script",
+	Long: `Record a migration as applied without running its up script, for changes
+that were made by hand.  Pending migrations before it are recorded as skipped
+so the next up still applies them.`,
+	Annotations: needs(needDatabase, needMigrations, needWrite),
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migration, err := migrations.Find(args[0])
+		if err != nil {
+			return err
 		}
+		if err := MarkApplied(db, migrations, migration, markReason); err != nil {
+			return err
+		}
+		green("marked %s %s applied\n", migration.Hash, migration.Path)
+		return nil
+	},
+}
 
-		if err := script(templates, values, "up"); err != nil {
+var markPendingCmd = &cobra.Command{
+	Use:   "pending {migration}",
+	Short: "Forget that a migration was applied without running its down script",
+	Long: `Forget that a migration was applied without running its down script, so the
+next up runs it again.  A migration applied before the last one is recorded as
+skipped.`,
+	Annotations: needs(needDatabase, needMigrations, needWrite),
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migration, err := migrations.Find(args[0])
+		if err != nil {
 			return err
 		}
-		if err := script(templates, values, "down"); err != nil {
+		if !confirmProtected(1) {
+			return errors.New("not marked pending")
+		}
+		if err := MarkPending(db, migrations, migration, markReason); err != nil {
 			return err
 		}
+		yellow("marked %s %s pending\n", migration.Hash, migration.Path)
+		return nil
+	},
+}
+
+/*
+ * confirmProtected asks before rolling back steps migrations in a protected
+ * environment.  Unprotected environments don't ask.
+ */
+func confirmProtected(steps int) bool {
+	if !viper.GetBool("protected") || steps == 0 {
+		return true
+	}
+	name := environmentName()
+	if name == "" {
+		name = "the database"
+	}
+	return confirm(fmt.Sprintf(
+		"%s is protected, roll back %d migrations?", name, steps))
+}
 
+/*
+ * confirm asks a yes or no question on the terminal.
+ */
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s y/n ", question)
+	reader := bufio.NewReader(os.Stdin)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.ToLower(strings.TrimSpace(answer)) == "y"
+}
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Work with the templates goose make uses",
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List the templates and the files each of them makes",
+	Annotations: needs(needConfig),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templates, err := loadTemplates()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if jsonOutput() {
+			documents := make([]Template, 0, len(names))
+			for _, name := range names {
+				documents = append(documents, templates[name])
+			}
+			return printJSON(documents)
+		}
+		for _, name := range names {
+			t := templates[name]
+			fmt.Printf("%-12s %s", t.Name, strings.Join(t.fileNames(), ", "))
+			cyan("  # %s\n", t.Source)
+		}
 		return nil
 	},
-	Args: cobra.ExactArgs(3),
 }
 
-func script(tmpls map[string]interface{}, values Values, fname string) error {
+var (
+	templateType string
+	makeVars     []string
+	makeAuthor   string
+)
+
+var makeCmd = &cobra.Command{
+	Use:   "make {message}",
+	Short: "Make a new migration",
+	Long: `Make a new migration.  The message is free text that is turned into the
+name of the migration directory.  The author is git's user.name and user.email
+unless --author is given, and is kept in migration.yaml.`,
+	Annotations: needs(needConfig),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slug := slugify(strings.Join(args, " "))
+		if slug == "" {
+			return errors.New("the message needs at least one letter or digit")
+		}
+		author, err := makeAuthorOf(viper.GetString("migration-repository"))
+		if err != nil {
+			return err
+		}
+
+		var tmpl Template
+		if desiredSchema == "" {
+			var err error
+			if tmpl, err = findTemplate(templateType); err != nil {
+				return err
+			}
+		}
+		vars, err := parseVars(makeVars)
+		if err != nil {
+			return err
+		}
+
+		naming := namingScheme()
+		parent := filepath.Join(
+			viper.GetString("migration-repository"),
+			viper.GetString("migration-directory"),
+		)
+		migration, err := naming.NewName(parent, author, slug)
+		if err != nil {
+			return err
+		}
+		directory := filepath.Join(parent, migration)
+		fmt.Println(directory)
+
+		timestamp := ""
+		if name, err := naming.Parse(migration); err == nil && naming.has("timestamp") {
+			timestamp = name.Timestamp.Format(naming.Timestamp)
+		}
+
+		if desiredSchema != "" {
+			if err := makeFromDiff(directory); err != nil {
+				return err
+			}
+		} else {
+			files, err := tmpl.Render(Values{
+				Migration: migration,
+				Author:    author.Name,
+				Email:     author.Email,
+				Directory: directory,
+				Timestamp: timestamp,
+				Vars:      vars,
+			})
+			if err != nil {
+				return err
+			}
+			// a template with its own migration.yaml sets the tags itself
+			if text, ok := files[metadataFile]; ok {
+				if files[metadataFile], err = withAuthor(text, author); err != nil {
+					return err
+				}
+				return writeMigrationFiles(directory, files)
+			}
+			if err := writeMigrationFiles(directory, files); err != nil {
+				return err
+			}
+		}
+
+		metadata, err := yaml.Marshal(Metadata{Author: author.String(), Tags: []string{templateType}})
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(directory, metadataFile), metadata, 0666)
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+/*
+ * makeAuthorOf returns the author given with --author or else the git user
+ * of the repository at path.
+ */
+func makeAuthorOf(path string) (Author, error) {
+	if makeAuthor != "" {
+		return parseAuthor(makeAuthor)
+	}
+	return gitAuthor(path)
+}
+
+var desiredSchema string
 
-	t, err := template.New("new").Parse(tmpls[fname].(string))
+/*
+ * makeFromDiff writes the scripts that move the configured database to the
+ * schema in --diff into directory.
+ */
+func makeFromDiff(directory string) error {
+	db, err := NewDatabase()
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
-	f, err := os.Create(
-		filepath.Join(values.Directory, fmt.Sprintf("%s.sql", fname)))
+	up, down, err := GenerateFromDiff(db, desiredSchema)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return t.Execute(f, values)
+	if up == "" {
+		return fmt.Errorf("the database already has the schema in %s", desiredSchema)
+	}
+
+	if err := os.Mkdir(directory, 0777); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(directory, "up.sql"), []byte(up), 0666); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(directory, "down.sql"), []byte(down), 0666)
 }
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_initStart(t *testing.T) {
+	defer func(saved Migrations) { migrations = saved; initAt = "" }(migrations)
+
+	date := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	migrations = Migrations{
+		{Hash: "aaa111", Path: "20200101_120000_a_a_a", MergedDate: date},
+		{Hash: "bbb222", Path: "20200102_120000_b_b_b", MergedDate: date.AddDate(0, 0, 1)},
+	}
+
+	start, err := initStart(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, start)
+
+	start, err = initStart([]string{"latest"})
+	assert.NoError(t, err)
+	assert.Equal(t, "bbb222", start.Hash)
+
+	start, err = initStart([]string{"20200101_120000_a_a_a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa111", start.Hash)
+
+	start, err = initStart([]string{"bbb"})
+	assert.NoError(t, err)
+	assert.Equal(t, "bbb222", start.Hash)
+
+	_, err = initStart([]string{"ccc"})
+	assert.Error(t, err)
+
+	initAt = "2020-01-01"
+	start, err = initStart(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa111", start.Hash, "merged during the day")
+
+	initAt = "2020-01-02T00:00:00Z"
+	start, err = initStart(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa111", start.Hash)
+
+	initAt = "2020-01-02"
+	start, err = initStart(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "bbb222", start.Hash)
+
+	_, err = initStart([]string{"latest"})
+	assert.Error(t, err)
+
+	initAt = "2019-12-31"
+	_, err = initStart(nil)
+	assert.Error(t, err)
+}
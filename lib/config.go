@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const configName = ".goose.yaml"
+
+// configFile is the file given with --config
+var configFile string
+
+// configSources maps every setting read from a file to where it came from
+var configSources = map[string]string{}
+
+/*
+ * configFlags are the global flags that override settings, keyed by setting.
+ */
+var configFlags = map[string]string{
+	"database-url":         "database-url",
+	"migration-repository": "repo",
+}
+
+/*
+ * loadConfig reads the configuration in layers where each layer overrides
+ * the one before it:
+ *
+ *   1. the first .goose.yaml found walking up from the working directory
+ *   2. $HOME/.goose.yaml
+ *   3. the file given with --config
+ *   4. the selected environment from the environments section
+ *   5. GOOSE_* environment variables, e.g. GOOSE_DATABASE_URL
+ *   6. the --database-url and --repo flags
+ */
+func loadConfig() error {
+	files := []string{}
+	if repo, err := findRepoConfig(); err != nil {
+		return err
+	} else if repo != "" {
+		files = append(files, repo)
+	}
+
+	if home, err := homedir.Dir(); err == nil {
+		user := filepath.Join(home, configName)
+		if _, err := os.Stat(user); err == nil && (len(files) == 0 || files[0] != user) {
+			files = append(files, user)
+		}
+	}
+
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return fmt.Errorf("can not read config file %s: %s", configFile, err)
+		}
+		files = append(files, configFile)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf(
+			"no %s found in this directory, its parents or your home directory; "+
+				"create one or pass --config", configName)
+	}
+
+	for _, file := range files {
+		settings, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		recordSources(settings, "", file)
+		if err := viper.MergeConfigMap(settings); err != nil {
+			return err
+		}
+	}
+
+	if err := selectEnvironment(); err != nil {
+		return err
+	}
+
+	viper.SetEnvPrefix("GOOSE")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
+
+	for key, flag := range configFlags {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * findRepoConfig walks up from the working directory and returns the first
+ * .goose.yaml it finds, or an empty string if there is none.
+ */
+func findRepoConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, configName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func readConfigFile(path string) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("can not read config file %s: %s", path, err)
+	}
+	return v.AllSettings(), nil
+}
+
+/*
+ * recordSources remembers source as the origin of every setting in settings.
+ */
+func recordSources(settings map[string]interface{}, prefix, source string) {
+	for key, value := range settings {
+		key = strings.ToLower(prefix + key)
+		if nested, ok := value.(map[string]interface{}); ok {
+			recordSources(nested, key+".", source)
+			continue
+		}
+		configSources[key] = source
+	}
+}
+
+/*
+ * ConfigSetting is a single effective setting and where its value came from.
+ */
+type ConfigSetting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+/*
+ * effectiveConfig returns every setting with secrets redacted.
+ */
+func effectiveConfig(flags *pflag.FlagSet) []ConfigSetting {
+	settings := []ConfigSetting{}
+	for _, key := range viper.AllKeys() {
+		settings = append(settings, ConfigSetting{
+			Key:    key,
+			Value:  redactSetting(key, viper.Get(key)),
+			Source: settingSource(key, flags),
+		})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+func settingSource(key string, flags *pflag.FlagSet) string {
+	if name, ok := configFlags[key]; ok {
+		if flag := flags.Lookup(name); flag != nil && flag.Changed {
+			return fmt.Sprintf("flag --%s", name)
+		}
+	}
+
+	env := "GOOSE_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+	if _, ok := os.LookupEnv(env); ok {
+		return fmt.Sprintf("env %s", env)
+	}
+
+	if name := environmentName(); name != "" {
+		for _, env := range environments() {
+			if _, ok := env.Settings[key]; env.Name == name && ok {
+				return fmt.Sprintf("environments.%s", name)
+			}
+		}
+	}
+
+	if source, ok := configSources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+/*
+ * redactSetting formats value for display and hides passwords.
+ */
+func redactSetting(key string, value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+
+	switch {
+	case strings.HasSuffix(key, "database-url"):
+		return redactURL(text)
+	case strings.Contains(key, "password"):
+		return "xxxxx"
+	case strings.Contains(text, "\n"):
+		return fmt.Sprintf("%q", text)
+	}
+	return text
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	envVarRegex       = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	urlPasswordRegex  = regexp.MustCompile(`://[^:/@]*:([^@]+)@`)
+	dsnPasswordRegex  = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S+)`)
+	maskedPlaceholder = "xxxxx"
+)
+
+// secrets are masked in everything goose prints, targets add theirs while
+// others are printing
+var (
+	secrets     []string
+	secretsLock sync.RWMutex
+)
+
+/*
+ * resolveDatabaseURL expands ${ENV_VAR} references in raw and fills in the
+ * password from password-file or password-command when the url has none.
+ * Anything still missing is left to lib/pq, which falls back to the PG*
+ * environment variables and ~/.pgpass.
+ */
+func resolveDatabaseURL(raw string) (string, error) {
+	var missing []string
+	resolved := envVarRegex.ReplaceAllStringFunc(raw, func(reference string) string {
+		name := envVarRegex.FindStringSubmatch(reference)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf(
+			"database-url uses unset environment variables %s", strings.Join(missing, ", "))
+	}
+	addSecretsFromURL(resolved)
+
+	password, err := configuredPassword()
+	if err != nil || password == "" || hasPassword(resolved) {
+		return resolved, err
+	}
+	addSecret(password)
+	return withPassword(resolved, password)
+}
+
+/*
+ * configuredPassword reads the password from password-file or the output of
+ * password-command, e.g. a password manager's cli.
+ */
+func configuredPassword() (string, error) {
+	if file := viper.GetString("password-file"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read password-file: %s", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if command := viper.GetString("password-command"); command != "" {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("run password-command: %s", err)
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	}
+	return "", nil
+}
+
+func isURL(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+func hasPassword(dsn string) bool {
+	if isURL(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil || u.User == nil {
+			return false
+		}
+		_, ok := u.User.Password()
+		return ok
+	}
+	return dsnPasswordRegex.MatchString(dsn)
+}
+
+/*
+ * withPassword sets password on a url or key=value connection string.
+ */
+func withPassword(dsn, password string) (string, error) {
+	if !isURL(dsn) {
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+		return strings.TrimSpace(fmt.Sprintf("%s password='%s'", dsn, escaped)), nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database-url: %s", mask(err.Error()))
+	}
+	username := ""
+	if u.User != nil {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), nil
+}
+
+func addSecret(secret string) {
+	if secret != "" {
+		secretsLock.Lock()
+		defer secretsLock.Unlock()
+		secrets = append(secrets, secret, url.QueryEscape(secret), url.PathEscape(secret))
+	}
+}
+
+/*
+ * addSecretsFromURL registers the password in dsn even if dsn doesn't parse,
+ * because parse errors quote the whole url.
+ */
+func addSecretsFromURL(dsn string) {
+	for _, regex := range []*regexp.Regexp{urlPasswordRegex, dsnPasswordRegex} {
+		for _, match := range regex.FindAllStringSubmatch(dsn, -1) {
+			addSecret(strings.Trim(match[1], "'"))
+			if decoded, err := url.PathUnescape(match[1]); err == nil {
+				addSecret(decoded)
+			}
+		}
+	}
+}
+
+/*
+ * mask replaces every known secret in text.
+ */
+func mask(text string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, maskedPlaceholder)
+	}
+	return text
+}
+
+/*
+ * maskWriter masks secrets in everything written through it.
+ */
+type maskWriter struct {
+	io.Writer
+}
+
+func (w maskWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.Writer, mask(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
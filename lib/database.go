@@ -1,85 +1,299 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	neturl "net/url"
+	"path/filepath"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
 )
 
 type DB struct {
 	*sql.DB
+
+	// Table is the quoted, schema qualified name of the goosey table
+	Table string
+
+	// History is the quoted, schema qualified name of the table that keeps a
+	// log of every change made to goosey
+	History string
+
+	// Name identifies the database in output when several are migrated
+	Name string
+
+	// Namespace limits schema dumps to a single schema, e.g. a tenant's
+	Namespace string
+
+	// Vars are substituted into migration scripts when they run
+	Vars map[string]string
 }
 
+/*
+ * label prefixes output with the name of the database if it has one.
+ */
+func (db DB) label() string {
+	if db.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", db.Name)
+}
+
+/*
+ * NewDatabase connects to the database of the selected environment.
+ */
 func NewDatabase() (*DB, error) {
-	url := viper.GetString("database-url")
+	return OpenDatabase(Target{
+		DatabaseURL: viper.GetString("database-url"),
+		Schema:      viper.GetString("schema"),
+		Table:       viper.GetString("table"),
+	})
+}
+
+/*
+ * OpenDatabase connects to the database of target and keeps track of
+ * migrations in the target's table, which lives in the target's schema when
+ * one is given.  See resolveDatabaseURL for how the url is completed.
+ */
+func OpenDatabase(target Target) (*DB, error) {
+	url, err := resolveDatabaseURL(target.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.SearchPath != "" {
+		if url, err = withSearchPath(url, target.SearchPath); err != nil {
+			return nil, err
+		}
+	}
+
 	db, err := sql.Open("postgres", url)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db}, db.Ping()
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	table := target.Table
+	if table == "" {
+		table = "goosey"
+	}
+	qualify := func(name string) string {
+		name = pq.QuoteIdentifier(name)
+		if target.Schema != "" {
+			name = pq.QuoteIdentifier(target.Schema) + "." + name
+		}
+		return name
+	}
+
+	vars := viper.GetStringMapString("vars")
+	for key, value := range target.Vars {
+		vars[strings.ToLower(key)] = value
+	}
+
+	database := &DB{
+		DB:        db,
+		Table:     qualify(table),
+		History:   qualify(table + "_history"),
+		Name:      target.Name,
+		Namespace: target.SearchPath,
+		Vars:      vars,
+	}
+	return database, database.upgradeGoosey()
 }
 
 /*
- * LastBatch will return the last marker and the number of steps to the
- * marker before that.
+ * withSearchPath sets the search_path of every connection made with dsn, so
+ * unqualified names in migration scripts resolve to schema.
  */
-func (db DB) LastBatch(instructions *Instructions) error {
-	var batch string
-	var hash string
-	var steps int
-	var rowid int
+func withSearchPath(dsn, schema string) (string, error) {
+	path := pq.QuoteIdentifier(schema)
+	if !isURL(dsn) {
+		return fmt.Sprintf("%s search_path='%s'", dsn, path), nil
+	}
+
+	u, err := neturl.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database-url: %s", mask(err.Error()))
+	}
+	query := u.Query()
+	query.Set("search_path", path)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+const (
+	statusApplied = "applied"
+	statusSkipped = "skipped"
+)
+
+// the actions recorded in the history table
+const (
+	actionUp          = "up"
+	actionDown        = "down"
+	actionSkip        = "skip"
+	actionInit        = "init"
+	actionBaseline    = "baseline"
+	actionMarkApplied = "mark applied"
+	actionMarkPending = "mark pending"
+)
+
+// the columns newer versions of goose added to goosey
+var upgradeColumns = []struct{ name, definition string }{
+	{"status", "TEXT NOT NULL DEFAULT 'applied'"},
+	{"fingerprint", "TEXT"},
+	{"snapshot", "TEXT"},
+	{"path", "TEXT"},
+}
+
+/*
+ * upgradeGoosey adds the columns newer versions of goose need to a goosey
+ * table created by an older version.  The history table is created next to
+ * it and starts out with the rows goosey already has.  Only what is missing
+ * is changed, so an up to date goosey is only read, which read only roles
+ * can do, and isn't locked.
+ */
+func (db DB) upgradeGoosey() error {
+	exists, err := db.HasGoosey()
+	if err != nil || !exists {
+		return err
+	}
+
+	columns := map[string]bool{}
 	rows, err := db.Query(`
-		( SELECT
-			a.batch, a.hash, b.steps, a.id
-		FROM goosey AS a JOIN (
-			SELECT
-				MAX (id) id, batch, COUNT(batch) steps
-			FROM goosey GROUP BY batch
-		) AS b
-			ON a.id = b.id
-			ORDER BY a.executed_at DESC LIMIT 1 )
-		UNION ALL
-		( SELECT
-			a.batch, a.hash, b.steps, a.id
-		FROM goosey AS a JOIN (
-			SELECT
-				MAX (id) id, batch, COUNT(batch) steps
-			FROM goosey GROUP BY batch
-		) AS b
-			ON a.id = b.id
-			ORDER BY a.executed_at ASC LIMIT 1 )
-		ORDER BY id DESC;
-	`)
+		SELECT attname FROM pg_attribute
+		WHERE attrelid = to_regclass($1) AND attnum > 0 AND NOT attisdropped
+	`, db.Table)
 	if err != nil {
 		return err
 	}
-	batches := make([]*Instructions, 0, 2)
-	for i := 0; rows.Next(); i++ {
-		if err = rows.Scan(&batch, &hash, &steps, &rowid); err != nil {
+	defer rows.Close()
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
 			return err
 		}
-		batches = append(batches, &Instructions{
-			BatchHash: batch,
-			LastHash:  hash,
-			Steps:     steps,
-		})
+		columns[column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var hasHistory bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, db.History).Scan(&hasHistory); err != nil {
+		return err
 	}
 
-	if len(batches) > 0 {
-		switch instructions.Action {
-		case pending:
-			instructions.Steps = -1
-		case rollback, redo:
-			instructions.Steps = batches[0].Steps
+	statements := []string{}
+	for _, column := range upgradeColumns {
+		if !columns[column.name] {
+			statements = append(statements, fmt.Sprintf(
+				"ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", db.Table, column.name, column.definition))
 		}
+	}
+	if !hasHistory {
+		statements = append(statements,
+			fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", db.History, historyColumns),
+			fmt.Sprintf(`
+			INSERT INTO %[2]s (
+				recorded_at, hash, path, batch, action
+			) SELECT
+				COALESCE(executed_at, NOW()), hash, path, batch,
+				CASE status WHEN 'skipped' THEN 'skip' ELSE 'up' END
+			FROM %[1]s
+			ORDER BY id`, db.Table, db.History))
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+	if dryRun {
+		return fmt.Errorf("%s was created by an older goose, upgrade it with a run without --dry-run", db.Table)
+	}
+	_, err = db.Exec(strings.Join(statements, ";\n") + ";")
+	return err
+}
+
+/*
+ * LastBatch will return the last marker and the number of steps to the
+ * marker before that.  The last marker is the newest row, which is where
+ * pending migrations start.  The last batch is the one executed last, which
+ * isn't the one with the newest row when a run only applied migrations that
+ * earlier runs skipped.
+ */
+func (db DB) LastBatch(instructions *Instructions) error {
+	var last, first Instructions
+	err := db.QueryRow(fmt.Sprintf(`
+		SELECT hash FROM %s ORDER BY id DESC LIMIT 1
+	`, db.Table)).Scan(&last.LastHash)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := db.QueryRow(fmt.Sprintf(`
+		SELECT
+			batch, COUNT(batch) steps
+		FROM %s GROUP BY batch
+		ORDER BY MAX(executed_at) DESC NULLS LAST, MAX(id) DESC LIMIT 1
+	`, db.Table)).Scan(&last.BatchHash, &last.Steps); err != nil {
+		return err
+	}
+
+	// the starting point of init has no batch and is never rolled back
+	if err := db.QueryRow(fmt.Sprintf(`
+		SELECT batch, hash FROM %[1]s WHERE id = (
+			SELECT MAX(id) FROM %[1]s GROUP BY batch ORDER BY MAX(id) ASC LIMIT 1
+		)
+	`, db.Table)).Scan(&first.BatchHash, &first.LastHash); err != nil {
+		return err
+	}
 
-		instructions.LastHash = batches[0].LastHash
-		if batches[1].BatchHash == "" {
-			instructions.ExcludeHash = batches[1].LastHash
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT hash FROM %s WHERE status = $1
+	`, db.Table), statusSkipped)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	skipped := map[string]bool{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
 		}
+		skipped[hash] = true
 	}
-	return err
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch instructions.Action {
+	case pending:
+		instructions.Steps = -1
+	case rollback, redo:
+		instructions.Steps = last.Steps
+	}
+
+	instructions.LastHash = last.LastHash
+	instructions.BatchHash = last.BatchHash
+	instructions.Skipped = skipped
+	if first.BatchHash == "" {
+		instructions.ExcludeHash = first.LastHash
+	}
+	return nil
+}
+
+/*
+ * execer is satisfied by *sql.DB, *sql.Conn and *sql.Tx so bookkeeping can
+ * happen inside or outside of a script's transaction.
+ */
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 /*
@@ -87,27 +301,245 @@ func (db DB) LastBatch(instructions *Instructions) error {
  * the migration afte
  */
 func (db DB) InsertLastMigration(script Script) error {
-	_, err := db.Exec(`
-		INSERT INTO goosey (
-			merged_at, hash, author, batch
-		) VALUES ($1, $2, $3, $4)
-	`, script.MergedDate, script.Hash, script.Author, script.Batch)
+	return db.insertMigration(context.Background(), db.DB, script, actionUp, "")
+}
+
+/*
+ * insertMigration records script as applied and logs action and reason in
+ * the history table.  A migration that an earlier run skipped keeps its row,
+ * and with it its place among the pending migrations, but moves to the new
+ * batch.
+ */
+func (db DB) insertMigration(ctx context.Context, ex execer, script Script, action, reason string) error {
+	result, err := ex.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s SET
+			status = $1, batch = $2, author = $3, executed_at = NOW()
+		WHERE hash = $4 AND status = $5
+	`, db.Table), statusApplied, script.Batch, script.Author, script.Hash, statusSkipped)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		if _, err := ex.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (
+				merged_at, hash, author, batch, status, path
+			) VALUES ($1, $2, $3, $4, $5, $6)
+		`, db.Table), script.MergedDate, script.Hash, script.Author, script.Batch, statusApplied, script.directory()); err != nil {
+			return err
+		}
+	}
+	return db.recordHistory(ctx, ex, script.Hash, action, reason)
+}
+
+/*
+ * SkipMigration records a migration that was left out of a run by a tag
+ * filter so that a later run can still apply it.
+ */
+func (db DB) SkipMigration(script Script) error {
+	return db.skipMigration(context.Background(), db.DB, script, "")
+}
+
+func (db DB) skipMigration(ctx context.Context, ex execer, script Script, reason string) error {
+	if _, err := ex.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (
+			merged_at, hash, author, batch, status, path
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`, db.Table), script.MergedDate, script.Hash, script.Author, script.Batch, statusSkipped, script.directory()); err != nil {
+		return err
+	}
+	return db.recordHistory(ctx, ex, script.Hash, actionSkip, reason)
+}
+
+/*
+ * recordHistory logs action on the goosey row of hash in the history table.
+ * It runs before a row is deleted so the log still knows its path and batch.
+ */
+func (db DB) recordHistory(ctx context.Context, ex execer, hash, action, reason string) error {
+	_, err := ex.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (
+			hash, path, batch, action, reason
+		) SELECT hash, path, batch, $2, NULLIF($3, '')
+		FROM %s WHERE hash = $1
+	`, db.History, db.Table), hash, action, reason)
 	return err
 }
 
+/*
+ * Record is a row of the goosey table.
+ */
+type Record struct {
+	ID         int       `json:"id"`
+	Hash       string    `json:"hash"`
+	Path       string    `json:"path,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Batch      string    `json:"batch"`
+	Status     string    `json:"status"`
+	MergedAt   time.Time `json:"merged_at"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+/*
+ * Records returns every row of goosey in the order they were added.
+ */
+func (db DB) Records() ([]Record, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT
+			id, hash, COALESCE(path, ''), COALESCE(author, ''), COALESCE(batch, ''), status,
+			COALESCE(merged_at, 'epoch'), COALESCE(executed_at, 'epoch')
+		FROM %s ORDER BY id
+	`, db.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(
+			&r.ID, &r.Hash, &r.Path, &r.Author, &r.Batch, &r.Status, &r.MergedAt, &r.ExecutedAt,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+/*
+ * HistoryEntry is a row of the history table, a change made to goosey.
+ */
+type HistoryEntry struct {
+	ID         int       `json:"id"`
+	RecordedAt time.Time `json:"recorded_at"`
+	RecordedBy string    `json:"recorded_by"`
+	Action     string    `json:"action"`
+	Hash       string    `json:"hash"`
+	Path       string    `json:"path,omitempty"`
+	Batch      string    `json:"batch"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+/*
+ * HistoryEntries returns every row of the history table in the order the
+ * changes were made.
+ */
+func (db DB) HistoryEntries() ([]HistoryEntry, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT
+			id, COALESCE(recorded_at, 'epoch'), COALESCE(recorded_by, ''), action,
+			COALESCE(hash, ''), COALESCE(path, ''), COALESCE(batch, ''), COALESCE(reason, '')
+		FROM %s ORDER BY id
+	`, db.History))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(
+			&e.ID, &e.RecordedAt, &e.RecordedBy, &e.Action, &e.Hash, &e.Path, &e.Batch, &e.Reason,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+/*
+ * Batch is a group of migrations that were executed together.
+ */
+type Batch struct {
+	Batch      string    `json:"batch"`
+	ExecutedAt time.Time `json:"executed_at"`
+	Hashes     []string  `json:"hashes"`
+}
+
+/*
+ * groupBatches groups records by their batch in the order the batches were
+ * first executed.
+ */
+func groupBatches(records []Record) []*Batch {
+	batches := []*Batch{}
+	byName := map[string]*Batch{}
+	for _, record := range records {
+		batch, ok := byName[record.Batch]
+		if !ok {
+			batch = &Batch{Batch: record.Batch, ExecutedAt: record.ExecutedAt}
+			byName[record.Batch] = batch
+			batches = append(batches, batch)
+		}
+		batch.Hashes = append(batch.Hashes, record.Hash)
+	}
+	return batches
+}
+
+/*
+ * RecordsByHash returns the rows of goosey keyed by hash.
+ */
+func (db DB) RecordsByHash() (map[string]Record, error) {
+	records, err := db.Records()
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]Record, len(records))
+	for _, record := range records {
+		byHash[record.Hash] = record
+	}
+	return byHash, nil
+}
+
 /*
  * DeleteLastMigration deletes a row from goosey.  If marker is true then the
  * last row in the table will have its marker column set to true.
  */
 func (db DB) DeleteLastMigration(hash string) error {
-	if _, err := db.Exec(`
-			DELETE FROM goosey WHERE hash = $1
-		`, hash); err != nil {
+	return db.deleteMigration(context.Background(), db.DB, hash, actionDown, "")
+}
+
+func (db DB) deleteMigration(ctx context.Context, ex execer, hash, action, reason string) error {
+	if err := db.recordHistory(ctx, ex, hash, action, reason); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE hash = $1
+		`, db.Table), hash); err != nil {
 		return err
 	}
 	return nil
 }
 
+/*
+ * unapplyMigration records that the migration of hash was rolled back.  The
+ * newest row is deleted, an older one is recorded as skipped so it keeps its
+ * place and the next up applies it again.
+ */
+func (db DB) unapplyMigration(ctx context.Context, ex execer, hash, action, reason string) error {
+	result, err := ex.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %[1]s SET status = $1
+		WHERE hash = $2 AND id < (SELECT MAX(id) FROM %[1]s)
+	`, db.Table), statusSkipped, hash)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return db.deleteMigration(ctx, ex, hash, action, reason)
+	}
+	return db.recordHistory(ctx, ex, hash, action, reason)
+}
+
 /*
  * RunScript executes a string of sql
  */
@@ -117,9 +549,149 @@ func (db DB) RunScript(script string) error {
 }
 
 /*
- * InitGoosey initializes the goosey table.
+ * ApplyScript runs the sql of script with the given postgres settings and
+ * records the result in goosey.
+ *
+ * In single transaction mode the settings are applied with SET LOCAL and the
+ * script and its goosey row are committed together.  In none mode the script
+ * manages its own transaction, so the settings are applied to the session and
+ * reset once the script is done, before its goosey row is written.  Errors of
+ * the script itself are scriptErrors.
+ */
+func (db DB) ApplyScript(script Script, sql string, mode string, settings map[string]string) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	record := func(ex execer) error {
+		if script.direction == Up {
+			return db.insertMigration(ctx, ex, script, actionUp, "")
+		}
+		return db.unapplyMigration(ctx, ex, script.Hash, actionDown, "")
+	}
+
+	if mode == transactionSingle {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err = setAll(ctx, tx, settings, true); err == nil {
+			if _, err = tx.ExecContext(ctx, sql); err != nil {
+				err = scriptError{err}
+			} else {
+				err = record(tx)
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+
+	reset := func() {
+		for name := range settings {
+			conn.ExecContext(ctx, fmt.Sprintf("RESET %s", name))
+		}
+	}
+	if err := setAll(ctx, conn, settings, false); err != nil {
+		reset()
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, sql); err != nil {
+		// if there was a transaction and it failed then we need to rollback
+		conn.ExecContext(ctx, `rollback`)
+		reset()
+		return scriptError{err}
+	}
+	// the timeouts are meant for the script, recording the script that
+	// already committed must not time out
+	reset()
+	return record(conn)
+}
+
+/*
+ * scriptError is an error of the statements of a script, as opposed to one
+ * of setting it up or recording it in goosey.
+ */
+type scriptError struct {
+	err error
+}
+
+func (e scriptError) Error() string { return e.err.Error() }
+func (e scriptError) Unwrap() error { return e.err }
+
+/*
+ * setAll applies each setting with set_config, which is SET LOCAL when local
+ * is true and SET otherwise.
+ */
+func setAll(ctx context.Context, ex execer, settings map[string]string, local bool) error {
+	for name, value := range settings {
+		if _, err := ex.ExecContext(ctx,
+			`SELECT set_config($1, $2, $3)`, name, value, local); err != nil {
+			return fmt.Errorf("set %s = %s: %s", name, value, err)
+		}
+	}
+	return nil
+}
+
+// gooseyColumns is the definition of the goosey table
+const gooseyColumns = `(
+	id          SERIAL PRIMARY KEY,
+	created_at  TIMESTAMPTZ,
+	merged_at   TIMESTAMPTZ,
+	executed_at TIMESTAMPTZ DEFAULT NOW(),
+	hash        TEXT,
+	author      TEXT,
+	batch       TEXT,
+	status      TEXT NOT NULL DEFAULT 'applied',
+	fingerprint TEXT,
+	snapshot    TEXT,
+	path        TEXT
+)`
+
+// historyColumns is the definition of the history table
+const historyColumns = `(
+	id          SERIAL PRIMARY KEY,
+	recorded_at TIMESTAMPTZ DEFAULT NOW(),
+	recorded_by TEXT DEFAULT current_user,
+	hash        TEXT,
+	path        TEXT,
+	batch       TEXT,
+	action      TEXT NOT NULL,
+	reason      TEXT
+)`
+
+/*
+ * EnsureGoosey creates the goosey and history tables if they don't exist yet.
+ */
+func (db DB) EnsureGoosey() error {
+	_, err := db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s %s;
+		CREATE TABLE IF NOT EXISTS %s %s;
+	`, db.Table, gooseyColumns, db.History, historyColumns))
+	return err
+}
+
+/*
+ * HasGoosey reports if the goosey table exists.
+ */
+func (db DB) HasGoosey() (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, db.Table).Scan(&exists)
+	return exists, err
+}
+
+/*
+ * InitGoosey creates the goosey table.  With a start migration goose treats
+ * it and every migration before it as applied.  force drops an existing
+ * goosey table first, the history table is kept.
  */
-func (db DB) InitGoosey(start string) error {
+func (db DB) InitGoosey(start *Migration, force bool) error {
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -134,27 +706,31 @@ func (db DB) InitGoosey(start string) error {
 		}
 	}()
 
-	_, err = tx.Exec(`
-		CREATE TABLE goosey (
-			id          SERIAL PRIMARY KEY,
-			created_at  TIMESTAMPTZ,
-			merged_at   TIMESTAMPTZ,
-			executed_at TIMESTAMPTZ DEFAULT NOW(),
-			hash        TEXT,
-			author      TEXT,
-			batch       TEXT
-		);
-	`)
+	if force {
+		if _, err = tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, db.Table)); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		CREATE TABLE %s %s;
+		CREATE TABLE IF NOT EXISTS %s %s;
+	`, db.Table, gooseyColumns, db.History, historyColumns))
 	if err != nil {
 		return err
 	}
 
-	if len(start) > 0 {
-		_, err = tx.Exec(`
-			INSERT INTO goosey
-				(hash, batch)
-			VALUES ($1, $2)
-		`, start, "")
+	if start == nil {
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %s (action) VALUES ($1)`, db.History), actionInit)
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s
+			(merged_at, hash, batch, path)
+		VALUES ($1, $2, $3, $4)
+	`, db.Table), start.MergedDate, start.Hash, "", filepath.Base(start.Path))
+	if err == nil {
+		err = db.recordHistory(context.Background(), tx, start.Hash, actionInit, "")
 	}
 	return err
 }
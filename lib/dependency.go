@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ * Order sorts the migrations so that every migration comes after the
+ * migrations it depends on.  Migrations without dependencies between them
+ * keep their commit order.  Missing dependencies and cycles are errors.
+ */
+func (migrations Migrations) Order() (Migrations, error) {
+	byName := make(map[string]*Migration, len(migrations))
+	for _, migration := range migrations {
+		byName[filepath.Base(migration.Path)] = migration
+	}
+
+	indegree := make(map[*Migration]int, len(migrations))
+	dependents := make(map[*Migration]Migrations, len(migrations))
+	for _, migration := range migrations {
+		for _, name := range migration.Metadata.DependsOn {
+			dependency, ok := byName[filepath.Base(name)]
+			if !ok {
+				return nil, fmt.Errorf(
+					"%s depends on %s which does not exist", migration.Path, name)
+			}
+			indegree[migration]++
+			dependents[dependency] = append(dependents[dependency], migration)
+		}
+	}
+
+	// ready is kept sorted by commit order so that independent migrations
+	// are applied in the order they were merged
+	ready := Migrations{}
+	for _, migration := range migrations {
+		if indegree[migration] == 0 {
+			ready = append(ready, migration)
+		}
+	}
+	sort.Sort(ready)
+
+	ordered := make(Migrations, 0, len(migrations))
+	for len(ready) > 0 {
+		next := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, next)
+
+		for _, dependent := range dependents[next] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		sort.Sort(ready)
+	}
+
+	if len(ordered) != len(migrations) {
+		cycle := []string{}
+		for _, migration := range migrations {
+			if indegree[migration] > 0 {
+				cycle = append(cycle, migration.Path)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+
+	for index, migration := range ordered {
+		migration.Index = index
+	}
+	return ordered, nil
+}
+
+/*
+ * Dependents returns the migrations that depend on migration.
+ */
+func (migrations Migrations) Dependents(migration *Migration) Migrations {
+	name := filepath.Base(migration.Path)
+	dependents := Migrations{}
+	for _, m := range migrations {
+		for _, dependency := range m.Metadata.DependsOn {
+			if filepath.Base(dependency) == name {
+				dependents = append(dependents, m)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+/*
+ * CheckRollback returns an error if any of the migrations about to be rolled
+ * back is depended on by an applied migration that stays applied, or is a
+ * baseline.
+ */
+func CheckRollback(applied, rollingBack Migrations) error {
+	leaving := make(map[*Migration]bool, len(rollingBack))
+	for _, migration := range rollingBack {
+		leaving[migration] = true
+	}
+
+	for _, migration := range rollingBack {
+		if migration.isBaseline() {
+			return fmt.Errorf(
+				"can not roll back %s, it is a baseline of squashed migrations", migration.Path)
+		}
+		for _, dependent := range applied.Dependents(migration) {
+			if !leaving[dependent] {
+				return fmt.Errorf(
+					"can not roll back %s, applied migration %s depends on it",
+					migration.Path, dependent.Path)
+			}
+		}
+	}
+	return nil
+}
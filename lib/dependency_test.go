@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDependencyMigrations(dependsOn map[string][]string) Migrations {
+	migrations := Migrations{}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		migrations = append(migrations, &Migration{
+			Index:    i,
+			Path:     name,
+			Hash:     name,
+			Metadata: Metadata{DependsOn: dependsOn[name]},
+		})
+	}
+	return migrations
+}
+
+var orderTests = []struct {
+	name      string
+	dependsOn map[string][]string
+	expected  []string
+	hasErr    bool
+}{
+	{"commit order", nil, []string{"a", "b", "c", "d"}, false},
+	{"dependency merged later", map[string][]string{"b": {"d"}}, []string{"a", "c", "d", "b"}, false},
+	{"chain", map[string][]string{"a": {"c"}, "c": {"d"}}, []string{"b", "d", "c", "a"}, false},
+	{"missing", map[string][]string{"a": {"z"}}, nil, true},
+	{"cycle", map[string][]string{"a": {"b"}, "b": {"a"}}, nil, true},
+}
+
+func Test_Order(t *testing.T) {
+	for _, tt := range orderTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := newDependencyMigrations(tt.dependsOn).Order()
+			if tt.hasErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for i, m := range ordered {
+				assert.Equal(t, tt.expected[i], m.Path)
+				assert.Equal(t, i, m.Index)
+			}
+		})
+	}
+}
+
+func Test_CheckRollback(t *testing.T) {
+	migrations := newDependencyMigrations(map[string][]string{"d": {"b"}})
+
+	err := CheckRollback(migrations, Migrations{migrations[1]})
+	assert.Error(t, err)
+
+	err = CheckRollback(migrations, Migrations{migrations[3], migrations[1]})
+	assert.NoError(t, err)
+
+	err = CheckRollback(migrations[:3], Migrations{migrations[1]})
+	assert.NoError(t, err)
+}
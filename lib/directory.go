@@ -2,8 +2,10 @@ package lib
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -21,16 +23,6 @@ const (
 	Up
 )
 
-var timeRegex *regexp.Regexp
-
-func init() {
-	if exp, err := regexp.Compile(`(\d{8}_\d{6})`); err != nil {
-		log.Fatal(err)
-	} else {
-		timeRegex = exp
-	}
-}
-
 /*
  * Migration has all the relative information needed to run up and down scripts.
  */
@@ -49,8 +41,14 @@ type Migration struct {
 	Up   Script
 	Down Script
 
+	// Metadata is read from the optional migration.yaml in the directory
+	Metadata Metadata
+
 	// Marker indicates if the migration is a stopping point in a batch
 	Marker string
+
+	// deleted is set when the directory is no longer in the repository
+	deleted bool
 }
 
 type Migrations []*Migration
@@ -61,48 +59,77 @@ func (m Migrations) Less(i, j int) bool { return m[i].Index < m[j].Index }
 
 /*
  * NewMigrations creates a list of all Migrations in the repository.  This
- * includes both executed and pending migrations.
+ * includes both executed and pending migrations ordered by their
+ * dependencies.
  */
-func NewMigrations() Migrations {
+func NewMigrations() (Migrations, error) {
 	path := viper.GetString("migration-repository")
-	migrations := new(Migrations).List(path)
-	return migrations
+	directory := viper.GetString("migration-directory")
+	migrations, err := new(Migrations).List(path, directory)
+	if err != nil {
+		return nil, err
+	}
+	return migrations.applySquashes().Order()
 }
 
 /*
  * List returns a sorted list of Migrations in descending order based on commit
- * time for the repository at the given path.
+ * time for the repository at the given path.  Only commits that add an up.sql
+ * to a directory in the migration directory are migrations.
  */
-func (migrations Migrations) List(path string) Migrations {
+func (migrations Migrations) List(path, directory string) (Migrations, error) {
 	cmd := exec.Command(
 		"git", "log", "--pretty=format:%H|%aD", "--name-status", "--diff-filter=A", "--reverse",
 	)
 	cmd.Dir = path
 
-	stdout, err := cmd.StdoutPipe()
+	output, err := cmd.Output()
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("git log in %s: %s", path, err)
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
-	}
-
-	scanner := bufio.NewScanner(stdout)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
 
 	index := 0
-	for scanner.Scan() {
+	more := scanner.Scan()
+	for more {
 		hash_date := strings.Split(scanner.Text(), "|")
 		hash := hash_date[0]
-		date := hash_date[1]
+		date := hash_date[len(hash_date)-1]
 		merged_timestamp, _ := parseTimeFromCommit(date)
 
-		scanner.Scan()
-		next := strings.Split(scanner.Text(), "\t")[1]
-		dir := filepath.Dir(next)
+		var files []string
+		files, more = scanBlock(scanner)
+		dir, ok := migrationPath(directory, files)
+		if !ok {
+			continue
+		}
+
+		// migrations deleted from the repository, e.g. after a squash, are
+		// only kept until applySquashes has placed their baseline
+		if _, err := os.Stat(filepath.Join(path, dir)); os.IsNotExist(err) {
+			migrations = append(migrations, &Migration{
+				Index:      index,
+				Path:       dir,
+				Hash:       hash,
+				MergedDate: merged_timestamp,
+				deleted:    true,
+			})
+			index += 1
+			continue
+		}
 
 		created_timestamp, _ := parseTimeFromPath(dir)
-		author, _ := parseAuthorFromPath(dir)
+		metadata, err := loadMetadata(filepath.Join(path, dir))
+		if err != nil {
+			return nil, err
+		}
+		// migrations made before the author was kept in migration.yaml have
+		// it in their directory name
+		author := metadata.Author
+		if author == "" {
+			author, _ = namingScheme().authorFromName(filepath.Base(dir))
+		}
 
 		migrations = append(migrations, &Migration{
 			Index:      index,
@@ -116,6 +143,9 @@ func (migrations Migrations) List(path string) Migrations {
 				CreateDate: created_timestamp,
 				Author:     author,
 				direction:  Up,
+
+				Timeouts:    metadata.Timeouts,
+				Transaction: metadata.Transaction,
 			},
 			Down: Script{
 				Hash:       hash,
@@ -124,19 +154,97 @@ func (migrations Migrations) List(path string) Migrations {
 				CreateDate: created_timestamp,
 				Author:     author,
 				direction:  Down,
+
+				Timeouts:    metadata.Timeouts,
+				Transaction: metadata.Transaction,
 			},
+			Metadata: metadata,
 		})
 		index += 1
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+/*
+ * scanBlock returns the files added by the current commit and moves the
+ * scanner to the next commit, if there is one.
+ */
+func scanBlock(scanner *bufio.Scanner) ([]string, bool) {
+	files := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) == 1 {
+			return files, true
+		}
+		files = append(files, parts[len(parts)-1])
+	}
+	return files, false
+}
+
+/*
+ * directoryPrefix returns the prefix of the files in the migration directory
+ * as git lists them.
+ */
+func directoryPrefix(directory string) string {
+	directory = filepath.ToSlash(filepath.Clean(directory))
+	if directory == "." {
+		return ""
+	}
+	return directory + "/"
+}
+
+/*
+ * migrationPath returns the directory of the migration a commit adds, which
+ * is where its up.sql is.  Commits that add no up.sql to a directory of the
+ * migration directory, like templates or a schema snapshot, add no migration.
+ */
+func migrationPath(directory string, files []string) (string, bool) {
+	prefix := directoryPrefix(directory)
+	for _, file := range files {
+		if !strings.HasPrefix(file, prefix) || strings.HasPrefix(file, templateDirectory+"/") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(file, prefix), "/")
+		if len(parts) == 2 && parts[1] == "up.sql" {
+			return filepath.FromSlash(prefix + parts[0]), true
+		}
+	}
+	return "", false
+}
+
+/*
+ * Find returns the migration whose directory name matches selector or whose
+ * hash starts with selector.  Selectors that match more than one migration
+ * are rejected.
+ */
+func (migrations Migrations) Find(selector string) (*Migration, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("no migration given")
+	}
 
-		// move to the next block
-		for scanner.Scan() {
-			next := scanner.Text()
-			if next == "" {
-				break
+	var found *Migration
+	for _, migration := range migrations {
+		if migration.Path == selector || filepath.Base(migration.Path) == selector {
+			return migration, nil
+		}
+		if strings.HasPrefix(migration.Hash, selector) {
+			if found != nil {
+				return nil, fmt.Errorf("%s matches more than one migration", selector)
 			}
+			found = migration
 		}
 	}
-	return migrations
+	if found == nil {
+		return nil, fmt.Errorf("no migration matches %s", selector)
+	}
+	return found, nil
 }
 
 func listUncommitted(path string) Migrations {
@@ -156,7 +264,6 @@ func listUncommitted(path string) Migrations {
 	}
 
 	scanner := bufio.NewScanner(stdout)
-	return nil
 
 	for scanner.Scan() {
 		scanner.Text()
@@ -174,12 +281,20 @@ func parseAuthorFromPath(path string) (string, error) {
 	return author, nil
 }
 
+/*
+ * parseTimeFromPath finds the timestamp of the naming scheme in path.
+ */
 func parseTimeFromPath(path string) (time.Time, error) {
-	match := timeRegex.FindAllString(path, 1)
-	if len(match) == 0 {
+	naming := namingScheme()
+	expr, err := regexp.Compile(naming.timestampRegex())
+	if err != nil || !naming.has("timestamp") {
+		return time.Time{}, fmt.Errorf("invalid directory name %s", path)
+	}
+	match := expr.FindString(path)
+	if match == "" {
 		return time.Time{}, fmt.Errorf("invalid directory name %s", path)
 	}
-	return time.Parse("20060102_030405", match[0])
+	return time.Parse(naming.Timestamp, match)
 }
 
 func parseTimeFromCommit(timestamp string) (time.Time, error) {
@@ -216,6 +331,11 @@ func (migrations *Migrations) Slice(instructions *Instructions) error {
 		sort.Sort(sort.Reverse(*migrations))
 	}
 
+	hash, err := migrations.resolveSquashed(hash, instructions.Skipped)
+	if err != nil {
+		return err
+	}
+
 	for index, migration := range *migrations {
 		if migration.Hash == hash {
 			// the start position for up should be the found index +1 because
@@ -236,6 +356,25 @@ func (migrations *Migrations) Slice(instructions *Instructions) error {
 	return fmt.Errorf("can not find index for %s", hash)
 }
 
+/*
+ * InBatch returns the migrations that batch applied, in the order of
+ * migrations.  Migrations the batch skipped and the starting point of init,
+ * which has no batch, are left out.
+ */
+func (migrations Migrations) InBatch(records map[string]Record, batch string) Migrations {
+	inBatch := Migrations{}
+	if batch == "" {
+		return inBatch
+	}
+	for _, migration := range migrations {
+		record, ok := records[migration.Hash]
+		if ok && record.Batch == batch && record.Status == statusApplied {
+			inBatch = append(inBatch, migration)
+		}
+	}
+	return inBatch
+}
+
 /*
  * boundary checks that our indices are within the bounds of the number of items
  * in a slice.
@@ -252,33 +391,127 @@ var yellow = color.New(color.FgYellow).PrintfFunc()
 var green = color.New(color.FgGreen).PrintfFunc()
 var blue = color.New(color.FgBlue).PrintfFunc()
 var cyan = color.New(color.FgCyan).PrintfFunc()
+var plain = color.New().PrintfFunc()
 
 /*
  * Execute will execute the scripts in the slice of migrations for a given
- * direction
+ * direction and stop at the first script that fails.
+ *
+ * Going up, migrations that don't match the instructions' tag filters are
+ * recorded as skipped instead of being executed.  Going down, skipped
+ * migrations only have their goosey row removed.
+ *
+ * A dry run renders the scripts and prints them, or adds them to the results
+ * in json mode, without running anything or changing goosey.
  */
-func (migrations Migrations) Execute(instructions *Instructions) error {
+func (migrations Migrations) Execute(db *DB, instructions *Instructions) ([]MigrationResult, error) {
+	results := []MigrationResult{}
 	var err error
+	exists := true
+	if instructions.DryRun {
+		// a dry run doesn't create goosey
+		if exists, err = db.HasGoosey(); err != nil {
+			return results, err
+		}
+	}
+	records := map[string]Record{}
+	if exists {
+		if records, err = db.RecordsByHash(); err != nil {
+			return results, err
+		}
+	}
+
 	batch := batchHash()
 	for _, migration := range migrations {
 		if migration.Hash == instructions.ExcludeHash {
-			fmt.Println("#")
-			return nil
+			progress(plain, "#\n")
+			return results, nil
 		}
+		record, recorded := records[migration.Hash]
+		skipped := recorded && record.Status == statusSkipped
+		started := time.Now()
+		direction := "up"
 		if instructions.Direction == Up {
-			green("↑ %s\n", migration.Hash)
-			migration.Up.Batch = batch
-			err = migration.Up.Execute(db)
+			// migrations are shared between databases migrated at the same
+			// time, so the batch is set on a copy
+			script := migration.Up
+			script.Batch = batch
+			if !migration.Metadata.Matches(instructions.Tags, instructions.ExcludeTags) {
+				if skipped {
+					continue
+				}
+				direction = "skip"
+				progress(cyan, "%s- %s\n", db.label(), migration.Hash)
+				if !instructions.DryRun {
+					err = db.SkipMigration(script)
+				}
+				results = append(results, newMigrationResult(migration, direction, batch, started, err))
+			} else {
+				progress(green, "%s↑ %s\n", db.label(), migration.Hash)
+				var sql string
+				sql, err = runScript(db, script, instructions.DryRun)
+				result := newMigrationResult(migration, direction, batch, started, err)
+				result.SQL = sql
+				results = append(results, result)
+			}
 		} else {
-			yellow("↓ %s\n", migration.Hash)
-			err = migration.Down.Execute(db)
+			direction = "down"
+			progress(yellow, "%s↓ %s\n", db.label(), migration.Hash)
+			if skipped {
+				if !instructions.DryRun {
+					err = db.DeleteLastMigration(migration.Hash)
+				}
+				results = append(results, newMigrationResult(migration, direction, record.Batch, started, err))
+			} else {
+				var sql string
+				sql, err = runScript(db, migration.Down, instructions.DryRun)
+				result := newMigrationResult(migration, direction, record.Batch, started, err)
+				result.SQL = sql
+				results = append(results, result)
+			}
+		}
+		if err != nil {
+			return results, err
 		}
-		// 		if err != nil {
-		// 			return err
-		// 		}
-		fmt.Println(err)
 	}
-	return nil
+	return results, nil
+}
+
+/*
+ * runScript executes script, or renders it and prints it in a dry run.  The
+ * rendered script is returned for the json output of a dry run.
+ */
+func runScript(db *DB, script Script, dryRun bool) (string, error) {
+	if !dryRun {
+		return "", script.Execute(db)
+	}
+	sql, err := script.Render(db)
+	if err != nil {
+		return "", err
+	}
+	if jsonOutput() {
+		return sql, nil
+	}
+	fmt.Printf("%s\n\n", strings.TrimRight(mask(sql), "\n"))
+	return "", nil
+}
+
+/*
+ * Skipped returns the migrations that an earlier run recorded as skipped.
+ */
+func (migrations Migrations) Skipped(db *DB) (Migrations, error) {
+	records, err := db.RecordsByHash()
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := Migrations{}
+	for _, migration := range migrations {
+		if records[migration.Hash].Status == statusSkipped {
+			skipped = append(skipped, migration)
+		}
+	}
+	return skipped, nil
 }
 
 func batchHash() string {
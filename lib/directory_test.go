@@ -99,7 +99,8 @@ func makeSqlScript(path, name, script string) error {
 
 func Test_Initial(t *testing.T) {
 
-	migrations := new(Migrations).List(migrationDirectory)
+	migrations, err := new(Migrations).List(migrationDirectory, "")
+	assert.NoError(t, err)
 
 	assert.Equal(t, 7, len(migrations))
 	order := []string{"a", "b", "c", "d", "e", "f", "g"}
@@ -170,6 +171,12 @@ var parseTimeFromPathTests = []struct {
 		false,
 		nil,
 	},
+	{
+		"20200101_150405_jane_doe_afternoon",
+		time.Date(2020, time.January, 1, 15, 4, 5, 0, time.UTC),
+		false,
+		nil,
+	},
 	{
 		"foo",
 		time.Time{},
@@ -314,7 +321,7 @@ func Test_SliceUp(t *testing.T) {
 				})
 			}
 
-			err := migrations.Slice(tt.hash, tt.steps, Up)
+			err := migrations.Slice(&Instructions{LastHash: tt.hash, Steps: tt.steps, Direction: Up})
 			assert.NoError(t, err)
 
 			assert.Equal(t, len(tt.expected), len(migrations))
@@ -373,7 +380,7 @@ func Test_SliceDown(t *testing.T) {
 				})
 			}
 
-			err := migrations.Slice(tt.hash, tt.steps, Down)
+			err := migrations.Slice(&Instructions{LastHash: tt.hash, Steps: tt.steps, Direction: Down})
 			assert.NoError(t, err)
 
 			assert.Equal(t, len(tt.expected), len(migrations))
@@ -384,3 +391,55 @@ func Test_SliceDown(t *testing.T) {
 		})
 	}
 }
+
+func Test_ListSkipsCommitsWithoutMigrations(t *testing.T) {
+	repo, err := ioutil.TempDir(os.TempDir(), "goosey-list-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	commit := func(message string, files ...string) {
+		for _, file := range files {
+			path := filepath.Join(repo, file)
+			assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+			assert.NoError(t, ioutil.WriteFile(path, []byte("SELECT 1;"), 0666))
+		}
+		assert.NoError(t, executeCommand("git", []string{"add", "."}, repo))
+		assert.NoError(t, executeCommand("git", []string{"commit", "-m", message}, repo))
+	}
+	assert.NoError(t, executeCommand("git", []string{"init"}, repo))
+	commit("templates", "templates/table/up.sql", "templates/table/down.sql")
+	commit("readme", "README.md")
+	commit("a", "migrations/20200101_120000_a_a_a/up.sql", "migrations/20200101_120000_a_a_a/down.sql")
+	commit("notes", "migrations/20200101_120000_a_a_a/notes.txt")
+	commit("b", "migrations/20200102_120000_b_b_b/down.sql", "migrations/20200102_120000_b_b_b/up.sql")
+
+	migrations, err := new(Migrations).List(repo, "migrations")
+	assert.NoError(t, err)
+	paths := []string{}
+	for _, migration := range migrations {
+		paths = append(paths, migration.Path)
+	}
+	assert.Equal(t, []string{"migrations/20200101_120000_a_a_a", "migrations/20200102_120000_b_b_b"}, paths)
+	assert.Equal(t, filepath.Join(repo, "migrations/20200102_120000_b_b_b/up.sql"), migrations[1].Up.Path)
+
+	commit("c", "20200103_120000_c_c_c/up.sql", "20200103_120000_c_c_c/down.sql")
+	commit("snapshot", "schema.sql")
+	migrations, err = new(Migrations).List(repo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(migrations), "templates, the snapshot and migrations in other directories are left out")
+	assert.Equal(t, "20200103_120000_c_c_c", migrations[0].Path)
+}
+
+func Test_InBatch(t *testing.T) {
+	migrations := newDependencyMigrations(map[string][]string{})
+	records := map[string]Record{
+		"a": {Hash: "a", Batch: "", Status: statusApplied},
+		"b": {Hash: "b", Batch: "y", Status: statusApplied},
+		"c": {Hash: "c", Batch: "x", Status: statusApplied},
+		"d": {Hash: "d", Batch: "y", Status: statusSkipped},
+	}
+
+	assert.Equal(t, Migrations{migrations[1]}, migrations.InBatch(records, "y"), "a skipped row isn't rolled back")
+	assert.Equal(t, Migrations{migrations[2]}, migrations.InBatch(records, "x"))
+	assert.Empty(t, migrations.InBatch(records, ""), "the starting point of init")
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ignoreDrift is set by --ignore-drift
+var ignoreDrift bool
+
+/*
+ * fingerprint identifies a schema.  Two schemas with the same fingerprint are
+ * the same.
+ */
+func (s Schema) fingerprint() string {
+	sum := sha256.Sum256([]byte(s.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+ * RecordSchema stores the fingerprint and the objects of schema on the last
+ * row of goosey, which ends the batch that was just run.
+ */
+func (db DB) RecordSchema(schema Schema) error {
+	snapshot, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`
+		UPDATE %[1]s SET fingerprint = $1, snapshot = $2
+		WHERE id = (SELECT MAX(id) FROM %[1]s)
+	`, db.Table), schema.fingerprint(), string(snapshot))
+	return err
+}
+
+/*
+ * RecordedSchema returns the schema stored with the newest row of goosey that
+ * has one.  Rows written by mark, by runs that only skipped migrations or by
+ * an older goose have none.  ok is false when no row has a schema.
+ */
+func (db DB) RecordedSchema() (schema Schema, ok bool, err error) {
+	var fingerprint, snapshot sql.NullString
+	err = db.QueryRow(fmt.Sprintf(`
+		SELECT fingerprint, snapshot FROM %s
+		WHERE snapshot IS NOT NULL ORDER BY id DESC LIMIT 1
+	`, db.Table)).Scan(&fingerprint, &snapshot)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal([]byte(snapshot.String), &schema); err != nil {
+		return nil, false, fmt.Errorf("read recorded schema: %s", err)
+	}
+	return schema, true, nil
+}
+
+/*
+ * recordFingerprint dumps the schema of db and records it with the last batch.
+ */
+func recordFingerprint(db *DB) (Schema, error) {
+	schema, err := db.DumpSchema()
+	if err != nil {
+		return nil, fmt.Errorf("dump schema: %s", err)
+	}
+	if err := db.RecordSchema(schema); err != nil {
+		return nil, fmt.Errorf("record schema fingerprint: %s", err)
+	}
+	return schema, nil
+}
+
+/*
+ * Drift compares the live schema of db with the schema recorded at the end of
+ * the last batch and returns the objects that changed outside of migrations.
+ * ok is false when no schema was recorded yet.
+ */
+func (db DB) Drift() (changes []SchemaChange, ok bool, err error) {
+	recorded, ok, err := db.RecordedSchema()
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	live, err := db.DumpSchema()
+	if err != nil {
+		return nil, false, err
+	}
+	if live.fingerprint() == recorded.fingerprint() {
+		return []SchemaChange{}, true, nil
+	}
+	return diffSchemas(recorded, live), true, nil
+}
+
+/*
+ * checkDrift fails when the schema of db was changed since the last batch.
+ */
+func checkDrift(db *DB) error {
+	if ignoreDrift {
+		return nil
+	}
+	changes, _, err := db.Drift()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, change := range changes {
+		progress(yellow, "%s%s %s %s\n", db.label(), change.Change, change.Kind, change.Name)
+	}
+	return fmt.Errorf(
+		"%sthe schema was changed outside of migrations in %d places, see goose drift or use --ignore-drift",
+		db.label(), len(changes))
+}
+
+func printDrift(changes []SchemaChange, ok bool) error {
+	if jsonOutput() {
+		if err := printJSON(changes); err != nil {
+			return err
+		}
+	} else if !ok {
+		fmt.Println("no schema was recorded yet, it is recorded by the next run of goose")
+	} else if len(changes) == 0 {
+		green("no drift\n")
+	} else {
+		for _, change := range changes {
+			color := yellow
+			switch change.Change {
+			case objectAdded:
+				color = green
+			case objectRemoved:
+				color = red
+			}
+			color("%s %s %s\n", change.Change, change.Kind, change.Name)
+			fmt.Print(change.Diff)
+		}
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("%d objects drifted from the last recorded schema", len(changes))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fingerprint(t *testing.T) {
+	schema := Schema{{Kind: "table", Name: "public.a", Definition: "CREATE TABLE public.a (\n    id integer\n)"}}
+
+	data, err := json.Marshal(schema)
+	assert.NoError(t, err)
+	var recorded Schema
+	assert.NoError(t, json.Unmarshal(data, &recorded))
+	assert.Equal(t, schema.fingerprint(), recorded.fingerprint())
+
+	altered := Schema{{Kind: "table", Name: "public.a", Definition: "CREATE TABLE public.a (\n    id bigint\n)"}}
+	assert.NotEqual(t, schema.fingerprint(), altered.fingerprint())
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// environment is the name given with --env
+var environment string
+
+/*
+ * Environment is a named set of settings in the environments section of
+ * .goose.yaml.  The settings of the selected environment override the top
+ * level ones.
+ */
+type Environment struct {
+	Name     string
+	Settings map[string]interface{}
+}
+
+/*
+ * environments returns the configured environments sorted by name.
+ */
+func environments() []Environment {
+	envs := []Environment{}
+	for name, settings := range viper.GetStringMap("environments") {
+		envs = append(envs, Environment{
+			Name:     name,
+			Settings: cast.ToStringMap(settings),
+		})
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	return envs
+}
+
+/*
+ * environmentName returns the environment to use.  --env wins over GOOSE_ENV
+ * which wins over default_env.  An empty name means no environment is used.
+ * Names are lower case like the keys viper reads from environments.
+ */
+func environmentName() string {
+	name := environment
+	if name == "" {
+		name = os.Getenv("GOOSE_ENV")
+	}
+	if name == "" {
+		name = viper.GetString("default_env")
+	}
+	return strings.ToLower(name)
+}
+
+/*
+ * selectEnvironment merges the settings of the selected environment over the
+ * top level settings.
+ */
+func selectEnvironment() error {
+	name := environmentName()
+	if name == "" {
+		return nil
+	}
+
+	for _, env := range environments() {
+		if env.Name == name {
+			return viper.MergeConfigMap(env.Settings)
+		}
+	}
+	return fmt.Errorf("unknown environment %s", name)
+}
+
+/*
+ * EnvironmentDocument is the json output for one environment.
+ */
+type EnvironmentDocument struct {
+	Name     string            `json:"name"`
+	Selected bool              `json:"selected"`
+	Settings map[string]string `json:"settings"`
+}
+
+func environmentDocuments(selected string) []EnvironmentDocument {
+	documents := []EnvironmentDocument{}
+	for _, env := range environments() {
+		settings := map[string]string{}
+		for key, value := range env.Settings {
+			settings[key] = redactSetting(key, value)
+		}
+		documents = append(documents, EnvironmentDocument{
+			Name:     env.Name,
+			Selected: env.Name == selected,
+			Settings: settings,
+		})
+	}
+	return documents
+}
+
+/*
+ * redactURL hides the password of a database url or a key=value connection
+ * string.
+ */
+func redactURL(raw string) string {
+	if !isURL(raw) {
+		return dsnPasswordRegex.ReplaceAllString(raw, "password="+maskedPlaceholder)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,25 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_selectEnvironment(t *testing.T) {
+	defer viper.Reset()
+	defer func() { environment = "" }()
+
+	viper.Set("environments", map[string]interface{}{
+		"production": map[string]interface{}{"table": "goosey_production"},
+	})
+
+	environment = "Production"
+	assert.Equal(t, "production", environmentName())
+	assert.NoError(t, selectEnvironment())
+	assert.Equal(t, "goosey_production", viper.GetString("table"))
+
+	environment = "staging"
+	assert.EqualError(t, selectEnvironment(), "unknown environment staging")
+}
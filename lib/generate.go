@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+/*
+ * GenerateFromDiff loads the desired schema in the file at path into a new
+ * scratch database and returns the up script that moves the schema of db to
+ * it and the down script that moves it back.
+ */
+func GenerateFromDiff(db *DB, path string) (string, string, error) {
+	desiredSQL, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	scratch, cleanup, err := openScratch("template0")
+	if err != nil {
+		return "", "", err
+	}
+	defer cleanup()
+
+	if _, err := scratch.Exec(string(desiredSQL)); err != nil {
+		return "", "", fmt.Errorf("load %s into the scratch database: %s", path, err)
+	}
+	desired, err := scratch.DumpSchema()
+	if err != nil {
+		return "", "", err
+	}
+	current, err := db.DumpSchema()
+	if err != nil {
+		return "", "", err
+	}
+	return migrationDDL(current, desired), migrationDDL(desired, current), nil
+}
+
+/*
+ * migrationDDL returns the statements that turn the schema from into to.
+ * Objects that can't be altered in place are dropped and created again.
+ */
+func migrationDDL(from, to Schema) string {
+	old := make(map[string]SchemaObject, len(from))
+	for _, object := range from {
+		old[object.key()] = object
+	}
+	next := make(map[string]SchemaObject, len(to))
+	for _, object := range to {
+		next[object.key()] = object
+	}
+
+	var drops, alters, creates []SchemaObject
+	for _, object := range from {
+		if _, ok := next[object.key()]; !ok {
+			drops = append(drops, object)
+		}
+	}
+	for _, object := range to {
+		previous, ok := old[object.key()]
+		switch {
+		case !ok:
+			creates = append(creates, object)
+		case previous.Definition == object.Definition:
+		case object.Kind == "table":
+			alters = append(alters, object)
+		case object.Kind == "function":
+			// pg_get_functiondef writes CREATE OR REPLACE
+			creates = append(creates, object)
+		default:
+			drops = append(drops, previous)
+			creates = append(creates, object)
+		}
+	}
+
+	// dependents are dropped before what they depend on and created after
+	sortForDDL(drops, []string{"view", "function", "constraint", "index", "table", "sequence", "extension", "schema"}, true)
+	sortForDDL(creates, []string{"schema", "extension", "sequence", "table", "constraint", "index", "function", "view"}, false)
+
+	statements := []string{}
+	for _, object := range drops {
+		statements = append(statements, dropStatement(object))
+	}
+	for _, object := range alters {
+		statements = append(statements, alterTable(old[object.key()], object)...)
+	}
+	for _, object := range creates {
+		statements = append(statements, strings.TrimRight(object.Definition, "; \n"))
+	}
+
+	var b strings.Builder
+	for _, statement := range statements {
+		fmt.Fprintf(&b, "%s;\n\n", statement)
+	}
+	return b.String()
+}
+
+/*
+ * sortForDDL orders objects by kind and puts foreign keys before or after the
+ * other constraints.
+ */
+func sortForDDL(objects []SchemaObject, kinds []string, foreignFirst bool) {
+	order := map[string]int{}
+	for i, kind := range kinds {
+		order[kind] = i
+	}
+	foreign := func(o SchemaObject) bool {
+		return o.Kind == "constraint" && strings.Contains(o.Definition, " FOREIGN KEY ")
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Kind != objects[j].Kind {
+			return order[objects[i].Kind] < order[objects[j].Kind]
+		}
+		if foreign(objects[i]) != foreign(objects[j]) {
+			return foreign(objects[i]) == foreignFirst
+		}
+		return objects[i].Name < objects[j].Name
+	})
+}
+
+func dropStatement(object SchemaObject) string {
+	switch object.Kind {
+	case "constraint":
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+			object.Table, strings.TrimPrefix(object.Name, object.Table+"."))
+	case "view":
+		if strings.HasPrefix(object.Definition, "CREATE MATERIALIZED VIEW") {
+			return fmt.Sprintf("DROP MATERIALIZED VIEW %s", object.Name)
+		}
+	}
+	return fmt.Sprintf("DROP %s %s", strings.ToUpper(object.Kind), object.Name)
+}
+
+/*
+ * alterTable returns the statements that turn the columns of table from into
+ * the columns of to.
+ */
+func alterTable(from, to SchemaObject) []string {
+	old := map[string]SchemaColumn{}
+	for _, column := range from.Columns {
+		old[column.Name] = column
+	}
+	next := map[string]bool{}
+	for _, column := range to.Columns {
+		next[column.Name] = true
+	}
+
+	statements := []string{}
+	alter := func(format string, args ...interface{}) {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ", to.Name)+fmt.Sprintf(format, args...))
+	}
+	for _, column := range from.Columns {
+		if !next[column.Name] {
+			alter("DROP COLUMN %s", column.Name)
+		}
+	}
+	for _, column := range to.Columns {
+		previous, ok := old[column.Name]
+		if !ok {
+			alter("ADD COLUMN %s", column)
+			continue
+		}
+		if previous.Type != column.Type {
+			alter("ALTER COLUMN %s TYPE %s", column.Name, column.Type)
+		}
+		if previous.Identity != column.Identity {
+			if previous.Identity != "" {
+				alter("ALTER COLUMN %s DROP IDENTITY", column.Name)
+			}
+			if column.Identity != "" {
+				alter("ALTER COLUMN %s ADD GENERATED %s AS IDENTITY", column.Name, column.Identity)
+			}
+		}
+		if previous.Default != column.Default {
+			if column.Default == "" {
+				alter("ALTER COLUMN %s DROP DEFAULT", column.Name)
+			} else {
+				alter("ALTER COLUMN %s SET DEFAULT %s", column.Name, column.Default)
+			}
+		}
+		if previous.NotNull != column.NotNull {
+			if column.NotNull {
+				alter("ALTER COLUMN %s SET NOT NULL", column.Name)
+			} else {
+				alter("ALTER COLUMN %s DROP NOT NULL", column.Name)
+			}
+		}
+	}
+	return statements
+}
@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	usersTable = SchemaObject{
+		Kind:       "table",
+		Name:       "public.users",
+		Definition: "CREATE TABLE public.users (\n    id integer NOT NULL\n)",
+		Columns:    []SchemaColumn{{Name: "id", Type: "integer", NotNull: true}},
+	}
+	usersWithEmail = SchemaObject{
+		Kind:       "table",
+		Name:       "public.users",
+		Definition: "CREATE TABLE public.users (\n    id integer NOT NULL,\n    email text DEFAULT ''::text\n)",
+		Columns: []SchemaColumn{
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "email", Type: "text", Default: "''::text"},
+		},
+	}
+	usersKey = SchemaObject{
+		Kind:       "constraint",
+		Name:       "public.users.users_pkey",
+		Definition: "ALTER TABLE public.users ADD CONSTRAINT users_pkey PRIMARY KEY (id)",
+		Table:      "public.users",
+	}
+	ordersTable = SchemaObject{
+		Kind:       "table",
+		Name:       "public.orders",
+		Definition: "CREATE TABLE public.orders (\n    user_id integer\n)",
+		Columns:    []SchemaColumn{{Name: "user_id", Type: "integer"}},
+	}
+	eventsTable = SchemaObject{
+		Kind: "table",
+		Name: "public.events",
+		Definition: "CREATE TABLE public.events (\n    id serial NOT NULL,\n" +
+			"    seq bigint GENERATED ALWAYS AS IDENTITY NOT NULL\n)",
+		Columns: []SchemaColumn{
+			{Name: "id", Type: "serial", NotNull: true},
+			{Name: "seq", Type: "bigint", NotNull: true, Identity: "ALWAYS"},
+		},
+	}
+	eventsWithoutIdentity = SchemaObject{
+		Kind:       "table",
+		Name:       "public.events",
+		Definition: "CREATE TABLE public.events (\n    id serial NOT NULL,\n    seq bigint NOT NULL\n)",
+		Columns: []SchemaColumn{
+			{Name: "id", Type: "serial", NotNull: true},
+			{Name: "seq", Type: "bigint", NotNull: true},
+		},
+	}
+	ordersUser = SchemaObject{
+		Kind:       "constraint",
+		Name:       "public.orders.orders_user_fkey",
+		Definition: "ALTER TABLE public.orders ADD CONSTRAINT orders_user_fkey FOREIGN KEY (user_id) REFERENCES public.users(id)",
+		Table:      "public.orders",
+	}
+)
+
+var migrationDDLTests = []struct {
+	name     string
+	from     Schema
+	to       Schema
+	expected string
+}{
+	{
+		"nothing",
+		Schema{usersTable},
+		Schema{usersTable},
+		"",
+	},
+	{
+		"create tables",
+		Schema{},
+		Schema{ordersUser, ordersTable, usersKey, usersTable},
+		"CREATE TABLE public.orders (\n    user_id integer\n);\n\n" +
+			"CREATE TABLE public.users (\n    id integer NOT NULL\n);\n\n" +
+			"ALTER TABLE public.users ADD CONSTRAINT users_pkey PRIMARY KEY (id);\n\n" +
+			"ALTER TABLE public.orders ADD CONSTRAINT orders_user_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);\n\n",
+	},
+	{
+		"drop tables",
+		Schema{ordersUser, ordersTable, usersKey, usersTable},
+		Schema{},
+		"ALTER TABLE public.orders DROP CONSTRAINT orders_user_fkey;\n\n" +
+			"ALTER TABLE public.users DROP CONSTRAINT users_pkey;\n\n" +
+			"DROP TABLE public.orders;\n\n" +
+			"DROP TABLE public.users;\n\n",
+	},
+	{
+		"add column",
+		Schema{usersTable},
+		Schema{usersWithEmail},
+		"ALTER TABLE public.users ADD COLUMN email text DEFAULT ''::text;\n\n",
+	},
+	{
+		"drop column",
+		Schema{usersWithEmail},
+		Schema{usersTable},
+		"ALTER TABLE public.users DROP COLUMN email;\n\n",
+	},
+	{
+		"create serial and identity columns",
+		Schema{},
+		Schema{eventsTable},
+		"CREATE TABLE public.events (\n    id serial NOT NULL,\n" +
+			"    seq bigint GENERATED ALWAYS AS IDENTITY NOT NULL\n);\n\n",
+	},
+	{
+		"drop serial and identity columns with their sequences",
+		Schema{eventsTable},
+		Schema{},
+		"DROP TABLE public.events;\n\n",
+	},
+	{
+		"add identity",
+		Schema{eventsWithoutIdentity},
+		Schema{eventsTable},
+		"ALTER TABLE public.events ALTER COLUMN seq ADD GENERATED ALWAYS AS IDENTITY;\n\n",
+	},
+}
+
+func Test_SchemaColumnString(t *testing.T) {
+	for _, column := range eventsTable.Columns {
+		assert.Contains(t, eventsTable.Definition, column.String())
+	}
+}
+
+func Test_migrationDDL(t *testing.T) {
+	for _, tt := range migrationDDLTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, migrationDDL(tt.from, tt.to))
+		})
+	}
+}
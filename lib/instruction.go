@@ -19,8 +19,18 @@ type Instructions struct {
 	LastHash    string
 	Action      action
 
+	// Skipped holds the hashes goosey records as skipped
+	Skipped map[string]bool
+
 	Steps     int
 	Direction int
+
+	// Tags and ExcludeTags limit which migrations an up run applies
+	Tags        []string
+	ExcludeTags []string
+
+	// DryRun prints the rendered scripts instead of running them
+	DryRun bool
 }
 
 func NewInstructions(action action, args ...string) *Instructions {
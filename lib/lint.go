@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+var (
+	alterTableRegex  = regexp.MustCompile(`(?i)^ALTER TABLE (?:IF EXISTS )?(?:ONLY )?("?[\w.]+"?)`)
+	addColumnRegex   = regexp.MustCompile(`(?i)^ADD (?:COLUMN )?(?:IF NOT EXISTS )?"?\w+"? `)
+	addConstraint    = regexp.MustCompile(`(?i)^ADD (?:CONSTRAINT|PRIMARY KEY|UNIQUE|FOREIGN KEY|CHECK|EXCLUDE)\b`)
+	notNullRegex     = regexp.MustCompile(`(?i)\bNOT NULL\b`)
+	defaultRegex     = regexp.MustCompile(`(?i)\bDEFAULT\b`)
+	dropColumnRegex  = regexp.MustCompile(`(?i)^DROP (?:COLUMN )?(?:IF EXISTS )?"?\w+"?`)
+	dropConstraint   = regexp.MustCompile(`(?i)^DROP CONSTRAINT\b`)
+	dropTableRegex   = regexp.MustCompile(`(?i)^DROP TABLE\b`)
+	columnTypeRegex  = regexp.MustCompile(`(?i)^ALTER (?:COLUMN )?"?\w+"? (?:SET DATA )?TYPE\b`)
+	createIndexRegex = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX\b`)
+	concurrentRegex  = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX CONCURRENTLY\b`)
+	updateRegex      = regexp.MustCompile(`(?i)^(?:WITH .* )?UPDATE\b`)
+	deleteRegex      = regexp.MustCompile(`(?i)^(?:WITH .* )?DELETE FROM\b`)
+	whereRegex       = regexp.MustCompile(`(?i)\bWHERE\b`)
+	renameRegex      = regexp.MustCompile(`(?i)^ALTER \w+ .*\bRENAME\b`)
+)
+
+/*
+ * LintRule is a check for a risky pattern in a migration script.  Check
+ * returns a message for a statement that breaks the rule.
+ */
+type LintRule struct {
+	Name string
+
+	// UpOnly rules don't apply to down scripts, which are expected to undo
+	// what the up script created
+	UpOnly bool
+
+	Check func(statement Statement) string
+}
+
+var lintRules = []LintRule{
+	{
+		Name: "not-null-without-default",
+		Check: func(statement Statement) string {
+			for _, clause := range alterClauses(statement.Text) {
+				if addColumnRegex.MatchString(clause) && !addConstraint.MatchString(clause) &&
+					notNullRegex.MatchString(clause) && !defaultRegex.MatchString(clause) {
+					return "adding a NOT NULL column without a default fails on tables with rows"
+				}
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "drop-column",
+		UpOnly: true,
+		Check: func(statement Statement) string {
+			for _, clause := range alterClauses(statement.Text) {
+				if dropColumnRegex.MatchString(clause) && !dropConstraint.MatchString(clause) {
+					return "dropping a column breaks code that still reads it"
+				}
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "drop-table",
+		UpOnly: true,
+		Check: func(statement Statement) string {
+			if dropTableRegex.MatchString(statement.Text) {
+				return "dropping a table can not be undone by the down script"
+			}
+			return ""
+		},
+	},
+	{
+		Name: "alter-column-type",
+		Check: func(statement Statement) string {
+			match := alterTableRegex.FindStringSubmatch(statement.Text)
+			if match == nil || !isLargeTable(match[1]) {
+				return ""
+			}
+			for _, clause := range alterClauses(statement.Text) {
+				if columnTypeRegex.MatchString(clause) {
+					return "changing a column type rewrites the table while holding an exclusive lock"
+				}
+			}
+			return ""
+		},
+	},
+	{
+		Name: "index-without-concurrently",
+		Check: func(statement Statement) string {
+			if createIndexRegex.MatchString(statement.Text) && !concurrentRegex.MatchString(statement.Text) {
+				return "creating an index without CONCURRENTLY blocks writes to the table"
+			}
+			return ""
+		},
+	},
+	{
+		Name: "update-without-where",
+		Check: func(statement Statement) string {
+			if updateRegex.MatchString(statement.Text) && !whereRegex.MatchString(statement.Text) {
+				return "UPDATE without WHERE changes every row"
+			}
+			return ""
+		},
+	},
+	{
+		Name: "delete-without-where",
+		Check: func(statement Statement) string {
+			if deleteRegex.MatchString(statement.Text) && !whereRegex.MatchString(statement.Text) {
+				return "DELETE without WHERE removes every row"
+			}
+			return ""
+		},
+	},
+	{
+		Name: "rename",
+		Check: func(statement Statement) string {
+			if renameRegex.MatchString(statement.Text) {
+				return "renaming breaks code that still uses the old name"
+			}
+			return ""
+		},
+	},
+}
+
+/*
+ * alterClauses returns the comma separated actions of an ALTER TABLE
+ * statement, or nothing for other statements.
+ */
+func alterClauses(text string) []string {
+	match := alterTableRegex.FindStringIndex(text)
+	if match == nil {
+		return nil
+	}
+
+	clauses := []string{}
+	depth, start := 0, match[1]
+	for i := start; i <= len(text); i++ {
+		if i == len(text) || (text[i] == ',' && depth == 0) {
+			clauses = append(clauses, strings.TrimSpace(text[start:i]))
+			start = i + 1
+			continue
+		}
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	return clauses
+}
+
+/*
+ * isLargeTable reports whether table is listed in lint.large-tables.  With no
+ * list every table counts as large.
+ */
+func isLargeTable(table string) bool {
+	large := viper.GetStringSlice("lint.large-tables")
+	if len(large) == 0 {
+		return true
+	}
+	table = strings.ToLower(strings.Trim(table, `"`))
+	for _, name := range large {
+		name = strings.ToLower(name)
+		if table == name || strings.HasSuffix(table, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * enabledRules returns the rules not turned off in the lint.rules section of
+ * .goose.yaml.  Every rule is on by default.
+ */
+func enabledRules() ([]LintRule, error) {
+	settings := cast.ToStringMap(viper.Get("lint.rules"))
+	known := map[string]bool{}
+	for _, rule := range lintRules {
+		known[rule.Name] = true
+	}
+	for name := range settings {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown lint rule %s", name)
+		}
+	}
+
+	rules := []LintRule{}
+	for _, rule := range lintRules {
+		enabled, ok := settings[rule.Name]
+		if !ok || cast.ToBool(enabled) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+/*
+ * Finding is a statement that breaks a lint rule.
+ */
+type Finding struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d %s: %s", f.Path, f.Line, f.Rule, f.Message)
+}
+
+/*
+ * lintScript checks every statement of sql against rules.
+ */
+func lintScript(path, sql string, up bool, rules []LintRule) []Finding {
+	findings := []Finding{}
+	for _, statement := range splitStatements(sql) {
+		for _, rule := range rules {
+			if (rule.UpOnly && !up) || statement.Ignored[rule.Name] {
+				continue
+			}
+			if message := rule.Check(statement); message != "" {
+				findings = append(findings, Finding{path, statement.Line, rule.Name, message})
+			}
+		}
+	}
+	return findings
+}
+
+/*
+ * Lint checks the up and down scripts in each of the migration directories.
+ */
+func Lint(dirs []string) ([]Finding, error) {
+	rules, err := enabledRules()
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []Finding{}
+	for _, dir := range dirs {
+		for _, script := range []string{"up.sql", "down.sql"} {
+			path := filepath.Join(dir, script)
+			sql, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, lintScript(path, string(sql), script == "up.sql", rules)...)
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var lintScriptTests = []struct {
+	name     string
+	sql      string
+	up       bool
+	expected []string
+}{
+	{"not null without default", "alter table a add column b int not null;", true, []string{"not-null-without-default"}},
+	{"not null with default", "alter table a add column b int not null default 0;", true, []string{}},
+	{"not null check constraint", "alter table users add constraint users_email_not_null check (email is not null) not valid;", true, []string{}},
+	{"not null check", "alter table users add check (email is not null);", true, []string{}},
+	{"column named like a constraint", "alter table a add check_flag int not null;", true, []string{"not-null-without-default"}},
+	{"second clause", "alter table a add column b int, add c text not null;", true, []string{"not-null-without-default"}},
+	{"drop column", "alter table a drop column b;", true, []string{"drop-column"}},
+	{"drop constraint", "alter table a drop constraint b;", true, []string{}},
+	{"drop column in down", "alter table a drop column b;", false, []string{}},
+	{"drop table", "drop table a;", true, []string{"drop-table"}},
+	{"column type", "alter table a alter column b type bigint;", true, []string{"alter-column-type"}},
+	{"index", "create index a_b on a (b);", true, []string{"index-without-concurrently"}},
+	{"concurrent index", "create unique index concurrently a_b on a (b);", true, []string{}},
+	{"update", "update a set b = 1;", true, []string{"update-without-where"}},
+	{"update where", "update a set b = 1 where c = 2;", true, []string{}},
+	{"delete", "delete from a;", false, []string{"delete-without-where"}},
+	{"rename", "alter table a rename column b to c;", true, []string{"rename"}},
+	{"quoted", "insert into a values ('drop table a');", true, []string{}},
+	{"ignored", "-- goose:ignore drop-table\ndrop table a;", true, []string{}},
+}
+
+func Test_lintScript(t *testing.T) {
+	for _, tt := range lintScriptTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := []string{}
+			for _, finding := range lintScript("up.sql", tt.sql, tt.up, lintRules) {
+				rules = append(rules, finding.Rule)
+			}
+			assert.Equal(t, tt.expected, rules)
+		})
+	}
+}
+
+func Test_enabledRules(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("lint.rules", map[string]interface{}{"rename": false})
+	rules, err := enabledRules()
+	assert.NoError(t, err)
+	assert.Len(t, rules, len(lintRules)-1)
+	for _, rule := range rules {
+		assert.NotEqual(t, "rename", rule.Name)
+	}
+
+	viper.Set("lint.rules", map[string]interface{}{"renames": false})
+	_, err = enabledRules()
+	assert.Error(t, err)
+}
+
+func Test_isLargeTable(t *testing.T) {
+	defer viper.Reset()
+
+	assert.True(t, isLargeTable("events"))
+	viper.Set("lint.large-tables", []string{"events"})
+	assert.True(t, isLargeTable("public.events"))
+	assert.False(t, isLargeTable("users"))
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * Author is who made a migration.
+ */
+type Author struct {
+	Name  string
+	Email string
+}
+
+func (a Author) String() string {
+	if a.Email == "" {
+		return a.Name
+	}
+	return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+}
+
+/*
+ * parseAuthor parses an author given as "Name <email>" or just "Name".
+ */
+func parseAuthor(value string) (Author, error) {
+	value = strings.TrimSpace(value)
+	author := Author{Name: value}
+	if open := strings.Index(value, "<"); open >= 0 {
+		if !strings.HasSuffix(value, ">") {
+			return Author{}, fmt.Errorf("invalid author %s, expected Name <email>", value)
+		}
+		author.Name = strings.TrimSpace(value[:open])
+		author.Email = strings.TrimSpace(value[open+1 : len(value)-1])
+	}
+	if author.Name == "" {
+		return Author{}, fmt.Errorf("invalid author %s, the name is missing", value)
+	}
+	return author, nil
+}
+
+/*
+ * gitAuthor returns the user.name and user.email git uses for commits in the
+ * repository at path.
+ */
+func gitAuthor(path string) (Author, error) {
+	config := func(key string) string {
+		cmd := exec.Command("git", "config", key)
+		cmd.Dir = path
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		// a key that isn't set makes git exit with 1
+		cmd.Run()
+		return strings.TrimSpace(out.String())
+	}
+	author := Author{Name: config("user.name"), Email: config("user.email")}
+	if author.Name == "" {
+		return Author{}, fmt.Errorf("git config user.name is not set, set it or use --author")
+	}
+	return author, nil
+}
+
+/*
+ * slugify turns a free text message into a directory name friendly slug of
+ * lower case words joined by underscores.
+ */
+func slugify(message string) string {
+	words := strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
+}
+
+/*
+ * withAuthor adds the author to the migration.yaml a template rendered,
+ * unless the template set one itself.  The rendered text is kept as is so
+ * its comments survive.
+ */
+func withAuthor(text string, author Author) (string, error) {
+	var metadata Metadata
+	if err := yaml.UnmarshalStrict([]byte(text), &metadata); err != nil {
+		return "", fmt.Errorf("%s of the template: %s", metadataFile, err)
+	}
+	if metadata.Author != "" {
+		return text, nil
+	}
+	line, err := yaml.Marshal(map[string]string{"author": author.String()})
+	if err != nil {
+		return "", err
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + string(line), nil
+}
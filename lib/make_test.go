@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var slugifyTests = []struct {
+	message  string
+	expected string
+}{
+	{"add_users", "add_users"},
+	{"Add users table", "add_users_table"},
+	{"  Add e-mail to users (JIRA-123)!  ", "add_e_mail_to_users_jira_123"},
+	{"Ändere Größe", "ändere_größe"},
+	{"--", ""},
+}
+
+func Test_slugify(t *testing.T) {
+	for _, tt := range slugifyTests {
+		t.Run(tt.message, func(t *testing.T) {
+			assert.Equal(t, tt.expected, slugify(tt.message))
+		})
+	}
+}
+
+var parseAuthorTests = []struct {
+	value    string
+	expected Author
+	hasErr   bool
+}{
+	{"Jane Doe <jane@example.com>", Author{"Jane Doe", "jane@example.com"}, false},
+	{"Jane Doe", Author{"Jane Doe", ""}, false},
+	{"Jane Doe <jane@example.com", Author{}, true},
+	{"<jane@example.com>", Author{}, true},
+	{"", Author{}, true},
+}
+
+func Test_parseAuthor(t *testing.T) {
+	for _, tt := range parseAuthorTests {
+		t.Run(tt.value, func(t *testing.T) {
+			author, err := parseAuthor(tt.value)
+			if tt.hasErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, author)
+		})
+	}
+}
+
+func Test_withAuthor(t *testing.T) {
+	author := Author{"Jane Doe", "jane@example.com"}
+
+	text, err := withAuthor("# made from the table template\ntags: [schema]", author)
+	assert.NoError(t, err)
+	assert.Equal(t, "# made from the table template\ntags: [schema]\nauthor: Jane Doe <jane@example.com>\n", text)
+
+	text, err = withAuthor("author: John Doe\n", author)
+	assert.NoError(t, err)
+	assert.Equal(t, "author: John Doe\n", text)
+
+	_, err = withAuthor("unknown: true\n", author)
+	assert.Error(t, err)
+}
+
+func Test_gitAuthor(t *testing.T) {
+	repo, err := ioutil.TempDir(os.TempDir(), "goosey-author-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	assert.NoError(t, executeCommand("git", []string{"init"}, repo))
+	assert.NoError(t, executeCommand("git", []string{"config", "user.name", "Jane Doe"}, repo))
+	assert.NoError(t, executeCommand("git", []string{"config", "user.email", "jane@example.com"}, repo))
+
+	author, err := gitAuthor(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, Author{"Jane Doe", "jane@example.com"}, author)
+}
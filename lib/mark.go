@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+/*
+ * MarkApplied records migration as applied in db without running its up
+ * script, for changes that were already made by hand.  Pending migrations
+ * before it are recorded as skipped so they stay pending.  The action and
+ * reason are logged in the history table.
+ */
+func MarkApplied(db *DB, all Migrations, migration *Migration, reason string) error {
+	pending, err := pendingMigrations(db, all)
+	if err != nil {
+		return err
+	}
+	records, err := db.RecordsByHash()
+	if err != nil {
+		return err
+	}
+	skips, err := markSkips(pending, records, migration)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	batch := batchHash()
+	for _, skipped := range skips {
+		script := skipped.Up
+		script.Batch = batch
+		if err = db.skipMigration(ctx, tx, script, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	script := migration.Up
+	script.Batch = batch
+	if err = db.insertMigration(ctx, tx, script, actionMarkApplied, reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+ * markSkips returns the migrations that must be recorded as skipped before
+ * migration is marked applied: the pending ones that come before it and have
+ * no goosey row yet.  A migration that isn't pending, or that depends on one
+ * that is, can't be marked applied.
+ */
+func markSkips(pending Migrations, records map[string]Record, migration *Migration) (Migrations, error) {
+	isPending := make(map[string]bool, len(pending))
+	for _, m := range pending {
+		isPending[filepath.Base(m.Path)] = true
+	}
+	if !isPending[filepath.Base(migration.Path)] {
+		return nil, fmt.Errorf("%s is already applied", migration.Path)
+	}
+	for _, dependency := range migration.Metadata.DependsOn {
+		if isPending[filepath.Base(dependency)] {
+			return nil, fmt.Errorf(
+				"can not mark %s applied, it depends on pending migration %s", migration.Path, dependency)
+		}
+	}
+
+	skips := Migrations{}
+	for _, m := range pending {
+		if m == migration {
+			break
+		}
+		if _, recorded := records[m.Hash]; !recorded {
+			skips = append(skips, m)
+		}
+	}
+	return skips, nil
+}
+
+/*
+ * MarkPending forgets that migration was applied to db without running its
+ * down script.  The last applied migration loses its goosey row like it does
+ * when it is rolled back, an earlier one is recorded as skipped so the next
+ * up applies it again.  The action and reason are logged in the history
+ * table.
+ */
+func MarkPending(db *DB, all Migrations, migration *Migration, reason string) error {
+	applied, err := appliedMigrations(db, all)
+	if err != nil {
+		return err
+	}
+	records, err := db.RecordsByHash()
+	if err != nil {
+		return err
+	}
+	last := NewInstructions(pending)
+	if err := db.LastBatch(last); err != nil {
+		return err
+	}
+	if err := checkMarkPending(applied, records, migration); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if migration.Hash == last.LastHash {
+		err = db.deleteMigration(ctx, tx, migration.Hash, actionMarkPending, reason)
+	} else {
+		err = db.skipRecorded(ctx, tx, migration.Hash, reason)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+ * checkMarkPending returns an error if migration isn't applied, was applied
+ * before goose started keeping track of the database, or is depended on by
+ * an applied migration.
+ */
+func checkMarkPending(applied Migrations, records map[string]Record, migration *Migration) error {
+	isApplied := false
+	for _, m := range applied {
+		isApplied = isApplied || m == migration
+	}
+	if !isApplied {
+		return fmt.Errorf("%s is already pending", migration.Path)
+	}
+	// the starting point of init and baselines have no batch
+	if record, ok := records[migration.Hash]; !ok || record.Batch == "" {
+		return fmt.Errorf(
+			"can not mark %s pending, it was applied before goose was initialized", migration.Path)
+	}
+	return CheckRollback(applied, Migrations{migration})
+}
+
+/*
+ * skipRecorded turns the goosey row of an applied migration into a skipped
+ * one, which keeps its place in the batch order.
+ */
+func (db DB) skipRecorded(ctx context.Context, ex execer, hash, reason string) error {
+	if _, err := ex.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s SET status = $1 WHERE hash = $2
+	`, db.Table), statusSkipped, hash); err != nil {
+		return err
+	}
+	return db.recordHistory(ctx, ex, hash, actionMarkPending, reason)
+}
@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_markSkips(t *testing.T) {
+	migrations := newDependencyMigrations(map[string][]string{"d": {"b"}})
+	records := map[string]Record{"b": {Hash: "b", Status: statusSkipped}}
+
+	skips, err := markSkips(migrations[1:], records, migrations[3])
+	assert.Error(t, err, "d depends on pending b")
+
+	skips, err = markSkips(migrations[1:], records, migrations[2])
+	assert.NoError(t, err)
+	assert.Empty(t, skips, "b already has a skipped row")
+
+	skips, err = markSkips(migrations, nil, migrations[2])
+	assert.NoError(t, err)
+	assert.Equal(t, Migrations{migrations[0], migrations[1]}, skips)
+
+	_, err = markSkips(migrations[2:], nil, migrations[1])
+	assert.Error(t, err, "b is already applied")
+}
+
+func Test_checkMarkPending(t *testing.T) {
+	migrations := newDependencyMigrations(map[string][]string{"d": {"b"}})
+	records := map[string]Record{
+		"a": {Hash: "a", Batch: ""},
+		"b": {Hash: "b", Batch: "x"},
+		"c": {Hash: "c", Batch: "x"},
+		"d": {Hash: "d", Batch: "y"},
+	}
+
+	assert.NoError(t, checkMarkPending(migrations, records, migrations[2]))
+	assert.NoError(t, checkMarkPending(migrations, records, migrations[3]))
+	assert.Error(t, checkMarkPending(migrations, records, migrations[0]), "applied before init")
+	assert.Error(t, checkMarkPending(migrations, records, migrations[1]), "d depends on b")
+	assert.Error(t, checkMarkPending(migrations[:2], records, migrations[2]), "c is pending")
+}
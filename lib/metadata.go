@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// metadataFile is the optional file that sits beside up.sql and down.sql
+const metadataFile = "migration.yaml"
+
+/*
+ * Metadata is the optional information about a migration that is read from
+ * the migration.yaml file in the migration directory.
+ */
+type Metadata struct {
+	// Description is a free text explanation of what the migration does
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+
+	// Author is who made the migration, goose make writes the user.name and
+	// user.email from git
+	Author string `yaml:"author,omitempty" json:"author,omitempty"`
+
+	// Ticket is a link to the ticket that requested the migration
+	Ticket string `yaml:"ticket,omitempty" json:"ticket,omitempty"`
+
+	// Tags categorise the migration so runs can be limited to some of them.
+	// goose make tags a migration with the name of its template.
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	Timeouts Timeouts `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+
+	// Transaction is the transaction mode the scripts are executed with
+	Transaction string `yaml:"transaction,omitempty" json:"transaction,omitempty"`
+
+	// DependsOn is a list of migration directories that must be applied
+	// before this one
+	DependsOn []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+
+	// Irreversible marks a migration whose down script can not undo its up
+	Irreversible bool `yaml:"irreversible,omitempty" json:"irreversible,omitempty"`
+
+	// Squashes lists the migrations a baseline stands for, oldest first
+	Squashes []Squashed `yaml:"squashes,omitempty" json:"squashes,omitempty"`
+}
+
+/*
+ * Squashed is a migration that was squashed into a baseline.
+ */
+type Squashed struct {
+	Hash string `yaml:"hash" json:"hash"`
+	Path string `yaml:"path" json:"path"`
+}
+
+/*
+ * Timeouts are postgres durations, e.g. 5s or 1min, that bound how long a
+ * migration may wait.
+ */
+type Timeouts struct {
+	Lock      string `yaml:"lock_timeout,omitempty" json:"lock_timeout,omitempty"`
+	Statement string `yaml:"statement_timeout,omitempty" json:"statement_timeout,omitempty"`
+}
+
+/*
+ * loadMetadata reads the migration.yaml in directory.  A missing file is not
+ * an error and results in empty metadata.
+ */
+func loadMetadata(directory string) (Metadata, error) {
+	var metadata Metadata
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, metadataFile))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	} else if err != nil {
+		return metadata, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("%s: %s", filepath.Join(directory, metadataFile), err)
+	}
+	return metadata, nil
+}
+
+/*
+ * Matches reports if a migration with these tags should run for the given
+ * filters.  Without a tags filter every migration matches, otherwise the
+ * migration needs at least one of tags.  Any tag in exclude rules the migration out.
+ */
+func (metadata Metadata) Matches(tags, exclude []string) bool {
+	for _, tag := range metadata.Tags {
+		for _, excluded := range exclude {
+			if tag == excluded {
+				return false
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range metadata.Tags {
+		for _, wanted := range tags {
+			if tag == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
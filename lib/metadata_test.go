@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loadMetadataTests = []struct {
+	name     string
+	content  string
+	expected Metadata
+	hasErr   bool
+}{
+	{
+		"missing", "", Metadata{}, false,
+	},
+	{
+		"full",
+		`
+description: add users
+ticket: https://tickets/1
+tags: [schema]
+timeouts:
+  lock_timeout: 5s
+  statement_timeout: 1min
+transaction: single
+depends_on: [20200101_120000_a_a_a]
+irreversible: true
+`,
+		Metadata{
+			Description:  "add users",
+			Ticket:       "https://tickets/1",
+			Tags:         []string{"schema"},
+			Timeouts:     Timeouts{Lock: "5s", Statement: "1min"},
+			Transaction:  "single",
+			DependsOn:    []string{"20200101_120000_a_a_a"},
+			Irreversible: true,
+		},
+		false,
+	},
+	{
+		"unknown field", "descripton: typo", Metadata{}, true,
+	},
+}
+
+func Test_loadMetadata(t *testing.T) {
+	for _, tt := range loadMetadataTests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(os.TempDir(), "goosey-metadata-*")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			if tt.content != "" {
+				err = ioutil.WriteFile(filepath.Join(dir, metadataFile), []byte(tt.content), 0666)
+				assert.NoError(t, err)
+			}
+
+			metadata, err := loadMetadata(dir)
+			if tt.hasErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, metadata)
+			}
+		})
+	}
+}
+
+var matchesTests = []struct {
+	name     string
+	tags     []string
+	include  []string
+	exclude  []string
+	expected bool
+}{
+	{"no filters", []string{"schema"}, nil, nil, true},
+	{"untagged without filters", nil, nil, nil, true},
+	{"included", []string{"schema"}, []string{"schema"}, nil, true},
+	{"not included", []string{"data"}, []string{"schema"}, nil, false},
+	{"untagged not included", nil, []string{"schema"}, nil, false},
+	{"excluded", []string{"seed"}, nil, []string{"seed"}, false},
+	{"untagged not excluded", nil, nil, []string{"seed"}, true},
+	{"exclude wins", []string{"schema", "seed"}, []string{"schema"}, []string{"seed"}, false},
+}
+
+func Test_Matches(t *testing.T) {
+	for _, tt := range matchesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := Metadata{Tags: tt.tags}
+			assert.Equal(t, tt.expected, metadata.Matches(tt.include, tt.exclude))
+		})
+	}
+}
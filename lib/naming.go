@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// the defaults of the naming section of .goose.yaml
+const (
+	defaultNamingPattern   = "{timestamp}_{slug}"
+	defaultNamingTimestamp = "20060102_150405"
+	defaultNamingDigits    = 4
+)
+
+var placeholderRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+/*
+ * Naming is the scheme migration directories are named with.  Pattern holds
+ * the placeholders {timestamp}, {number}, {author} and {slug}, and is used
+ * both to name new migrations and to read existing names.
+ */
+type Naming struct {
+	Pattern string
+
+	// Timestamp is the numeric Go layout of {timestamp}
+	Timestamp string
+
+	// Digits is the width of {number}, which is padded with zeros
+	Digits int
+}
+
+/*
+ * Name is what a directory name holds according to the naming scheme.
+ */
+type Name struct {
+	Timestamp time.Time
+	Number    int
+	Author    string
+	Slug      string
+}
+
+/*
+ * namingScheme returns the naming scheme in the naming section of .goose.yaml.
+ */
+func namingScheme() Naming {
+	naming := Naming{
+		Pattern:   viper.GetString("naming.pattern"),
+		Timestamp: viper.GetString("naming.timestamp"),
+		Digits:    viper.GetInt("naming.digits"),
+	}
+	if naming.Pattern == "" {
+		naming.Pattern = defaultNamingPattern
+	}
+	if naming.Timestamp == "" {
+		naming.Timestamp = defaultNamingTimestamp
+	}
+	if naming.Digits <= 0 {
+		naming.Digits = defaultNamingDigits
+	}
+	return naming
+}
+
+/*
+ * has reports if the pattern uses placeholder.
+ */
+func (n Naming) has(placeholder string) bool {
+	return strings.Contains(n.Pattern, "{"+placeholder+"}")
+}
+
+/*
+ * check returns an error if names can't be made and read with the scheme.
+ */
+func (n Naming) check() error {
+	for _, match := range placeholderRegex.FindAllStringSubmatch(n.Pattern, -1) {
+		switch match[1] {
+		case "timestamp", "number", "author", "slug":
+		default:
+			return fmt.Errorf("naming.pattern: unknown placeholder %s", match[0])
+		}
+	}
+	if !n.has("slug") {
+		return fmt.Errorf("naming.pattern: %s has no {slug}", n.Pattern)
+	}
+	if n.has("timestamp") == n.has("number") {
+		return fmt.Errorf("naming.pattern: %s needs either {timestamp} or {number}", n.Pattern)
+	}
+	if _, err := time.Parse(n.Timestamp, time.Now().Format(n.Timestamp)); err != nil || n.timestampRegex() == "" {
+		return fmt.Errorf("naming.timestamp: %s is not a numeric Go time layout", n.Timestamp)
+	}
+	return nil
+}
+
+/*
+ * timestampRegex returns a regular expression for timestamps in the layout of
+ * the scheme, made by replacing the digits of a formatted time.
+ */
+func (n Naming) timestampRegex() string {
+	var b strings.Builder
+	digits := 0
+	for _, r := range time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(n.Timestamp) {
+		if r >= '0' && r <= '9' {
+			b.WriteString(`\d`)
+			digits++
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	if digits == 0 {
+		return ""
+	}
+	return b.String()
+}
+
+/*
+ * regexp returns the regular expression matching whole names, with a named
+ * group for each placeholder.
+ */
+func (n Naming) regexp() (*regexp.Regexp, error) {
+	if err := n.check(); err != nil {
+		return nil, err
+	}
+	groups := map[string]string{
+		"timestamp": n.timestampRegex(),
+		"number":    fmt.Sprintf(`\d{%d}`, n.Digits),
+		// like the {first}_{last} of the names goose used to make
+		"author": `[^_]*_[^_]*`,
+		"slug":   `.+`,
+	}
+	expr := "^"
+	last := 0
+	for _, match := range placeholderRegex.FindAllStringSubmatchIndex(n.Pattern, -1) {
+		name := n.Pattern[match[2]:match[3]]
+		expr += regexp.QuoteMeta(n.Pattern[last:match[0]])
+		expr += fmt.Sprintf("(?P<%s>%s)", name, groups[name])
+		last = match[1]
+	}
+	expr += regexp.QuoteMeta(n.Pattern[last:]) + "$"
+	return regexp.Compile(expr)
+}
+
+/*
+ * Parse reads a directory name with the scheme.
+ */
+func (n Naming) Parse(name string) (Name, error) {
+	expr, err := n.regexp()
+	if err != nil {
+		return Name{}, err
+	}
+	match := expr.FindStringSubmatch(name)
+	if match == nil {
+		return Name{}, fmt.Errorf("invalid directory name %s", name)
+	}
+
+	var parsed Name
+	for i, group := range expr.SubexpNames() {
+		switch group {
+		case "timestamp":
+			if parsed.Timestamp, err = time.Parse(n.Timestamp, match[i]); err != nil {
+				return Name{}, err
+			}
+		case "number":
+			if parsed.Number, err = strconv.Atoi(match[i]); err != nil {
+				return Name{}, err
+			}
+		case "author":
+			parsed.Author = strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(match[i]))
+		case "slug":
+			parsed.Slug = match[i]
+		}
+	}
+	return parsed, nil
+}
+
+/*
+ * key returns what has to be unique between the names of migrations.
+ */
+func (n Naming) key(name Name) string {
+	if n.has("number") {
+		return fmt.Sprintf("number %0*d", n.Digits, name.Number)
+	}
+	return "timestamp " + name.Timestamp.Format(n.Timestamp)
+}
+
+/*
+ * Generate makes the name of a migration from its parts.
+ */
+func (n Naming) Generate(name Name) string {
+	author := ""
+	if words := strings.Split(slugify(name.Author), "_"); len(words) > 1 {
+		author = words[0] + "_" + strings.Join(words[1:], "-")
+	} else {
+		author = words[0] + "_"
+	}
+	return strings.NewReplacer(
+		"{timestamp}", name.Timestamp.Format(n.Timestamp),
+		"{number}", fmt.Sprintf("%0*d", n.Digits, name.Number),
+		"{author}", author,
+		"{slug}", name.Slug,
+	).Replace(n.Pattern)
+}
+
+/*
+ * NewName names a new migration in directory.  With {number} the migration
+ * gets the number after the highest number in directory.
+ */
+func (n Naming) NewName(directory string, author Author, slug string) (string, error) {
+	if err := n.check(); err != nil {
+		return "", err
+	}
+	name := Name{Timestamp: time.Now(), Author: author.Name, Slug: slug}
+	if n.has("number") {
+		dirs, err := migrationDirectories(directory)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		name.Number = n.nextNumber(dirs)
+		if len(strconv.Itoa(name.Number)) > n.Digits {
+			return "", fmt.Errorf("naming.digits: %d digits are too few for number %d", n.Digits, name.Number)
+		}
+	}
+	return n.Generate(name), nil
+}
+
+/*
+ * nextNumber returns the number after the highest number of the names that
+ * follow the scheme.
+ */
+func (n Naming) nextNumber(names []string) int {
+	highest := 0
+	for _, name := range names {
+		if parsed, err := n.Parse(name); err == nil && parsed.Number > highest {
+			highest = parsed.Number
+		}
+	}
+	return highest + 1
+}
+
+/*
+ * authorFromName returns the author in a directory name.  Without {author}
+ * in the pattern it falls back to the {timestamp}_{first}_{last}_{message}
+ * names goose used to make.
+ */
+func (n Naming) authorFromName(name string) (string, error) {
+	if !n.has("author") {
+		return parseAuthorFromPath(name)
+	}
+	parsed, err := n.Parse(name)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Author, nil
+}
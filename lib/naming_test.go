@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var namingParseTests = []struct {
+	naming   Naming
+	name     string
+	expected Name
+	hasErr   bool
+}{
+	{
+		Naming{Pattern: "{timestamp}_{slug}", Timestamp: "20060102_150405"},
+		"20200101_150405_add_users",
+		Name{Timestamp: time.Date(2020, 1, 1, 15, 4, 5, 0, time.UTC), Slug: "add_users"},
+		false,
+	},
+	{
+		Naming{Pattern: "{timestamp}_{author}_{slug}", Timestamp: "20060102_150405"},
+		"20200101_120000_john_zoidberg_add_users",
+		Name{Timestamp: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), Author: "john zoidberg", Slug: "add_users"},
+		false,
+	},
+	{
+		Naming{Pattern: "{number}_{slug}", Timestamp: "20060102_150405", Digits: 4},
+		"0012_add_users",
+		Name{Number: 12, Slug: "add_users"},
+		false,
+	},
+	{
+		Naming{Pattern: "V{number}__{slug}", Timestamp: "20060102_150405", Digits: 3},
+		"V002__add_users",
+		Name{Number: 2, Slug: "add_users"},
+		false,
+	},
+	{
+		Naming{Pattern: "{timestamp}-{slug}", Timestamp: "2006-01-02T1504"},
+		"2020-01-01T1504-add_users",
+		Name{Timestamp: time.Date(2020, 1, 1, 15, 4, 0, 0, time.UTC), Slug: "add_users"},
+		false,
+	},
+	{
+		Naming{Pattern: "{number}_{slug}", Timestamp: "20060102_150405", Digits: 4},
+		"20200101_120000_add_users",
+		Name{},
+		true,
+	},
+	{
+		Naming{Pattern: "{timestamp}_{slug}", Timestamp: "20060102_150405"},
+		"add_users",
+		Name{},
+		true,
+	},
+}
+
+func Test_NamingParse(t *testing.T) {
+	for _, tt := range namingParseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := tt.naming.Parse(tt.name)
+			if tt.hasErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func Test_NamingGenerate(t *testing.T) {
+	timestamp := time.Date(2020, 1, 1, 15, 4, 5, 0, time.UTC)
+
+	legacy := Naming{Pattern: "{timestamp}_{author}_{slug}", Timestamp: "20060102_150405"}
+	name := legacy.Generate(Name{Timestamp: timestamp, Author: "Mary Ann Smith", Slug: "add_users"})
+	assert.Equal(t, "20200101_150405_mary_ann-smith_add_users", name)
+	parsed, err := legacy.Parse(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "mary ann smith", parsed.Author)
+
+	numbered := Naming{Pattern: "{number}_{slug}", Timestamp: "20060102_150405", Digits: 4}
+	assert.Equal(t, "0007_add_users", numbered.Generate(Name{Number: 7, Slug: "add_users"}))
+}
+
+func Test_nextNumber(t *testing.T) {
+	numbered := Naming{Pattern: "{number}_{slug}", Timestamp: "20060102_150405", Digits: 4}
+	assert.Equal(t, 1, numbered.nextNumber(nil))
+	assert.Equal(t, 13, numbered.nextNumber([]string{"0001_a", "0012_b", "0003_c", "20200101_120000_d", "templates"}))
+}
+
+var namingCheckTests = []struct {
+	naming Naming
+	hasErr bool
+}{
+	{Naming{Pattern: "{timestamp}_{slug}", Timestamp: "20060102_150405"}, false},
+	{Naming{Pattern: "{number}_{slug}", Timestamp: "20060102_150405"}, false},
+	{Naming{Pattern: "{timestamp}", Timestamp: "20060102_150405"}, true},
+	{Naming{Pattern: "{slug}", Timestamp: "20060102_150405"}, true},
+	{Naming{Pattern: "{timestamp}_{number}_{slug}", Timestamp: "20060102_150405"}, true},
+	{Naming{Pattern: "{date}_{slug}", Timestamp: "20060102_150405"}, true},
+	{Naming{Pattern: "{timestamp}_{slug}", Timestamp: "Jan"}, true},
+}
+
+func Test_NamingCheck(t *testing.T) {
+	for _, tt := range namingCheckTests {
+		t.Run(tt.naming.Pattern, func(t *testing.T) {
+			err := tt.naming.check()
+			if tt.hasErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is set by --output
+var outputFormat string
+
+/*
+ * initOutput checks --output and turns colors off for json.
+ */
+func initOutput() error {
+	switch outputFormat {
+	case outputText:
+	case outputJSON:
+		color.NoColor = true
+	default:
+		return fmt.Errorf("unknown output %s, use json or text", outputFormat)
+	}
+	return nil
+}
+
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+/*
+ * printJSON writes v to stdout as indented json with secrets masked.
+ */
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(maskWriter{os.Stdout})
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+/*
+ * MigrationResult is what happened to a single migration in a run.
+ */
+type MigrationResult struct {
+	Hash       string `json:"hash"`
+	Path       string `json:"path"`
+	Direction  string `json:"direction"`
+	Batch      string `json:"batch,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+
+	// SQL is the rendered script of a dry run
+	SQL string `json:"sql,omitempty"`
+}
+
+func newMigrationResult(migration *Migration, direction, batch string, started time.Time, err error) MigrationResult {
+	result := MigrationResult{
+		Hash:       migration.Hash,
+		Path:       migration.Path,
+		Direction:  direction,
+		Batch:      batch,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = mask(err.Error())
+	}
+	return result
+}
+
+/*
+ * RunDocument is the json output of commands that execute migrations.
+ */
+type RunDocument struct {
+	Command    string            `json:"command"`
+	Migrations []MigrationResult `json:"migrations"`
+	Targets    []TargetDocument  `json:"targets,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+/*
+ * TargetDocument is the json output for one target of a run.
+ */
+type TargetDocument struct {
+	Target     string            `json:"target"`
+	Result     string            `json:"result"`
+	Count      int               `json:"count"`
+	DurationMS int64             `json:"duration_ms"`
+	Migrations []MigrationResult `json:"migrations,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+/*
+ * reportRun prints the json document of a run in json mode and passes err
+ * through so commands can return it.
+ */
+func reportRun(command string, results []MigrationResult, err error) error {
+	if !jsonOutput() {
+		return err
+	}
+
+	document := RunDocument{Command: command, Migrations: results}
+	if document.Migrations == nil {
+		document.Migrations = []MigrationResult{}
+	}
+	if err != nil {
+		document.Error = mask(err.Error())
+	}
+	if printErr := printJSON(document); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+/*
+ * MigrationDocument is the json output for a single migration.
+ */
+type MigrationDocument struct {
+	Hash     string    `json:"hash"`
+	Path     string    `json:"path"`
+	Author   string    `json:"author,omitempty"`
+	Created  time.Time `json:"created"`
+	Merged   time.Time `json:"merged"`
+	State    string    `json:"state,omitempty"`
+	Metadata Metadata  `json:"metadata"`
+}
+
+func newMigrationDocument(migration *Migration, state string) MigrationDocument {
+	return MigrationDocument{
+		Hash:     migration.Hash,
+		Path:     migration.Path,
+		Author:   migration.Up.Author,
+		Created:  migration.Up.CreateDate,
+		Merged:   migration.MergedDate,
+		State:    state,
+		Metadata: migration.Metadata,
+	}
+}
+
+func printMigrations(migrations Migrations) error {
+	if !jsonOutput() {
+		for _, d := range migrations {
+			fmt.Println(d.Hash, d.Path)
+		}
+		return nil
+	}
+
+	documents := []MigrationDocument{}
+	for _, migration := range migrations {
+		documents = append(documents, newMigrationDocument(migration, ""))
+	}
+	return printJSON(documents)
+}
+
+/*
+ * progress prints a line of progress in text mode only.
+ */
+func progress(print func(format string, a ...interface{}), format string, args ...interface{}) {
+	if !jsonOutput() {
+		print(format, args...)
+	}
+}
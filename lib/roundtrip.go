@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	neturl "net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+/*
+ * RoundtripResult is the outcome of running a migration up, down and up again
+ * on the scratch database.
+ */
+type RoundtripResult struct {
+	Hash string `json:"hash"`
+	Path string `json:"path"`
+
+	// Down lists what the down script failed to undo
+	Down []SchemaChange `json:"down"`
+
+	// Redo lists what differs after running the up script a second time
+	Redo []SchemaChange `json:"redo"`
+
+	// Skipped is set for irreversible migrations, which are only applied
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (r RoundtripResult) passed() bool {
+	return r.Error == "" && len(r.Down) == 0 && len(r.Redo) == 0
+}
+
+/*
+ * scratchSetting returns the scratch setting key, falling back to the
+ * roundtrip section that held the scratch settings before other commands
+ * used the scratch database.
+ */
+func scratchSetting(key string) string {
+	if value := viper.GetString("scratch." + key); value != "" {
+		return value
+	}
+	return viper.GetString("roundtrip." + key)
+}
+
+/*
+ * openScratch connects to the scratch database in scratch.database-url.  With
+ * a template a new database is created from it on the same server and dropped
+ * again by the returned cleanup function.
+ */
+func openScratch(template string) (*DB, func(), error) {
+	scratch := scratchSetting("database-url")
+	if scratch == "" {
+		return nil, nil, fmt.Errorf("no scratch database, set scratch.database-url or use --scratch-url")
+	}
+	url, err := resolveDatabaseURL(scratch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if main, err := resolveDatabaseURL(viper.GetString("database-url")); err == nil && main == url {
+		return nil, nil, fmt.Errorf("the scratch database must not be the database goose migrates")
+	}
+
+	if template == "" {
+		db, err := OpenDatabase(Target{DatabaseURL: url, Name: "scratch"})
+		return db, func() {}, err
+	}
+
+	server, err := OpenDatabase(Target{DatabaseURL: url})
+	if err != nil {
+		return nil, nil, err
+	}
+	name := fmt.Sprintf("goose_scratch_%d", time.Now().UnixNano())
+	if _, err := server.Exec(fmt.Sprintf(`CREATE DATABASE %s TEMPLATE %s`,
+		pq.QuoteIdentifier(name), pq.QuoteIdentifier(template))); err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("create scratch database from %s: %s", template, err)
+	}
+	drop := func() {
+		if _, err := server.Exec(fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, pq.QuoteIdentifier(name))); err != nil {
+			// stdout may be carrying json, the leftover database is worth a log line
+			log.Printf("drop scratch database %s: %s", name, err)
+		}
+		server.Close()
+	}
+
+	url, err = withDatabaseName(url, name)
+	if err == nil {
+		var db *DB
+		if db, err = OpenDatabase(Target{DatabaseURL: url, Name: name}); err == nil {
+			return db, func() { db.Close(); drop() }, nil
+		}
+	}
+	drop()
+	return nil, nil, err
+}
+
+/*
+ * withDatabaseName points dsn at another database on the same server.
+ */
+func withDatabaseName(dsn, name string) (string, error) {
+	if !isURL(dsn) {
+		return fmt.Sprintf("%s dbname='%s'", dsn, name), nil
+	}
+	u, err := neturl.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database-url: %s", mask(err.Error()))
+	}
+	u.Path = "/" + name
+	return u.String(), nil
+}
+
+/*
+ * Roundtrip checks that the down script of every migration undoes its up
+ * script.  Each migration is run up, down and up again on db, which must be
+ * a scratch database, and the schema is compared after each step.  Every
+ * migration is left applied so the next one starts from the right schema.
+ * It stops at the first script that fails.
+ */
+func (migrations Migrations) Roundtrip(db *DB) []RoundtripResult {
+	results := []RoundtripResult{}
+	batch := batchHash()
+	for _, migration := range migrations {
+		result := RoundtripResult{
+			Hash: migration.Hash,
+			Path: migration.Path,
+			Down: []SchemaChange{},
+			Redo: []SchemaChange{},
+		}
+		err := roundtrip(db, migration, batch, &result)
+		if err != nil {
+			result.Error = mask(err.Error())
+		}
+		results = append(results, result)
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+func roundtrip(db *DB, migration *Migration, batch string, result *RoundtripResult) error {
+	up := migration.Up
+	up.Batch = batch
+
+	if migration.Metadata.Irreversible {
+		result.Skipped = true
+		progress(cyan, "%s↑ %s irreversible, only applied\n", db.label(), migration.Path)
+		return up.Execute(db)
+	}
+
+	before, err := db.DumpSchema()
+	if err != nil {
+		return err
+	}
+	progress(green, "%s↑ %s\n", db.label(), migration.Path)
+	if err := up.Execute(db); err != nil {
+		return err
+	}
+	applied, err := db.DumpSchema()
+	if err != nil {
+		return err
+	}
+
+	progress(yellow, "%s↓ %s\n", db.label(), migration.Path)
+	if err := migration.Down.Execute(db); err != nil {
+		return err
+	}
+	reverted, err := db.DumpSchema()
+	if err != nil {
+		return err
+	}
+
+	progress(green, "%s↑ %s\n", db.label(), migration.Path)
+	if err := up.Execute(db); err != nil {
+		return err
+	}
+	reapplied, err := db.DumpSchema()
+	if err != nil {
+		return err
+	}
+
+	result.Down = diffSchemas(before, reverted)
+	result.Redo = diffSchemas(applied, reapplied)
+	return nil
+}
+
+/*
+ * printRoundtripResults prints what each migration left behind, or a json
+ * document in json mode, and returns an error if any migration failed.
+ */
+func printRoundtripResults(results []RoundtripResult) error {
+	failed := 0
+	for _, result := range results {
+		if !result.passed() {
+			failed++
+		}
+	}
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d migrations failed the roundtrip", failed, len(results))
+	}
+
+	if jsonOutput() {
+		if printErr := printJSON(results); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	for _, result := range results {
+		if result.passed() {
+			green("ok   %s\n", result.Path)
+			continue
+		}
+		red("FAIL %s\n", result.Path)
+		if result.Error != "" {
+			fmt.Printf("  %s\n", result.Error)
+		}
+		for _, change := range result.Down {
+			fmt.Printf("  down.sql left %s\n", change)
+		}
+		for _, change := range result.Redo {
+			fmt.Printf("  up.sql after down.sql %s\n", change)
+		}
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scratchSetting(t *testing.T) {
+	defer viper.Reset()
+
+	assert.Equal(t, "", scratchSetting("database-url"))
+
+	viper.Set("roundtrip.database-url", "postgres://localhost/old")
+	viper.Set("roundtrip.template", "app_template")
+	assert.Equal(t, "postgres://localhost/old", scratchSetting("database-url"))
+	assert.Equal(t, "app_template", scratchSetting("template"))
+
+	viper.Set("scratch.database-url", "postgres://localhost/scratch")
+	assert.Equal(t, "postgres://localhost/scratch", scratchSetting("database-url"))
+}
@@ -0,0 +1,447 @@
+package lib
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// the kinds of schema objects in the order they are written
+var schemaKinds = []string{"schema", "extension", "sequence", "table", "constraint", "index", "view", "function"}
+
+/*
+ * SchemaObject is a single object of the database schema and the SQL that
+ * defines it.
+ */
+type SchemaObject struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+
+	// Table is the table a constraint belongs to
+	Table string `json:"table,omitempty"`
+
+	// Columns are the columns of a table
+	Columns []SchemaColumn `json:"columns,omitempty"`
+}
+
+/*
+ * SchemaColumn is a column of a table.
+ */
+type SchemaColumn struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"not_null,omitempty"`
+	Default string `json:"default,omitempty"`
+
+	// Identity is ALWAYS or BY DEFAULT for identity columns
+	Identity string `json:"identity,omitempty"`
+}
+
+// the serial types of the integer types of serial columns
+var serialTypes = map[string]string{
+	"smallint": "smallserial",
+	"integer":  "serial",
+	"bigint":   "bigserial",
+}
+
+/*
+ * String returns the column as it is written in CREATE TABLE.
+ */
+func (c SchemaColumn) String() string {
+	definition := fmt.Sprintf("%s %s", c.Name, c.Type)
+	if c.Identity != "" {
+		definition += fmt.Sprintf(" GENERATED %s AS IDENTITY", c.Identity)
+	}
+	if c.NotNull {
+		definition += " NOT NULL"
+	}
+	if c.Default != "" {
+		definition += " DEFAULT " + c.Default
+	}
+	return definition
+}
+
+func (o SchemaObject) key() string {
+	return o.Kind + " " + o.Name
+}
+
+/*
+ * Schema is every object of a database outside of the system schemas, sorted
+ * so two dumps of the same schema are identical.
+ */
+type Schema []SchemaObject
+
+func (s Schema) sort() {
+	order := map[string]int{}
+	for i, kind := range schemaKinds {
+		order[kind] = i
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Kind != s[j].Kind {
+			return order[s[i].Kind] < order[s[j].Kind]
+		}
+		return s[i].Name < s[j].Name
+	})
+}
+
+/*
+ * String returns the schema as SQL.
+ */
+func (s Schema) String() string {
+	var b strings.Builder
+	for _, object := range s {
+		fmt.Fprintf(&b, "-- %s %s\n%s;\n\n", object.Kind, object.Name, strings.TrimRight(object.Definition, "; \n"))
+	}
+	return b.String()
+}
+
+/*
+ * userObject filters out system schemas, schemas other than $2 when it is
+ * given, and objects that belong to extensions.  oid is the column with the
+ * object's oid.
+ */
+func userObject(oid string) string {
+	return fmt.Sprintf(`
+		n.nspname <> 'information_schema' AND n.nspname NOT LIKE 'pg\_%%'
+		AND ($2 = '' OR n.nspname = $2)
+		AND NOT EXISTS (
+			SELECT 1 FROM pg_depend e WHERE e.objid = %s AND e.deptype = 'e'
+		)`, oid)
+}
+
+/*
+ * gooseTables returns the tables goose keeps for itself, which are left out
+ * of schema dumps.
+ */
+func (db DB) gooseTables() []string {
+	return []string{db.Table, db.History}
+}
+
+/*
+ * DumpSchema reads the schema of the database from the catalog, leaving out
+ * goose's own tables.
+ */
+func (db DB) DumpSchema() (Schema, error) {
+	excluded := []int64{}
+	for _, table := range db.gooseTables() {
+		var oid int64
+		if err := db.QueryRow(`SELECT COALESCE(to_regclass($1)::oid, 0)`, table).Scan(&oid); err != nil {
+			return nil, err
+		}
+		excluded = append(excluded, oid)
+	}
+
+	schema := Schema{}
+	for _, dump := range []func(*Schema, []int64) error{
+		db.dumpSchemas, db.dumpExtensions, db.dumpTables, db.dumpConstraints, db.dumpIndexes, db.dumpViews, db.dumpFunctions, db.dumpSequences,
+	} {
+		if err := dump(&schema, excluded); err != nil {
+			return nil, err
+		}
+	}
+	schema.sort()
+	return schema, nil
+}
+
+func (db DB) dumpSchemas(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "schema", `
+		SELECT quote_ident(n.nspname), 'CREATE SCHEMA ' || quote_ident(n.nspname)
+		FROM pg_namespace n
+		WHERE n.nspname <> 'public' AND n.oid <> ALL($1) AND `+userObject("n.oid"), excluded)
+}
+
+func (db DB) dumpExtensions(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "extension", `
+		SELECT
+			quote_ident(x.extname),
+			'CREATE EXTENSION IF NOT EXISTS ' || quote_ident(x.extname)
+				|| ' WITH SCHEMA ' || quote_ident(n.nspname)
+		FROM pg_extension x
+		JOIN pg_namespace n ON n.oid = x.extnamespace
+		-- plpgsql is installed in every database
+		WHERE x.extname <> 'plpgsql' AND x.oid <> ALL($1)
+			AND ($2 = '' OR n.nspname = $2)`, excluded)
+}
+
+func (db DB) dumpTables(schema *Schema, excluded []int64) error {
+	rows, err := db.Query(`
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			quote_ident(a.attname), format_type(a.atttypid, a.atttypmod),
+			a.attnotnull, pg_get_expr(d.adbin, d.adrelid),
+			CASE a.attidentity WHEN 'a' THEN 'ALWAYS' WHEN 'd' THEN 'BY DEFAULT' ELSE '' END,
+			-- serial columns own the sequence of their default
+			a.attidentity = '' AND pg_get_serial_sequence(
+				quote_ident(n.nspname) || '.' || quote_ident(c.relname), a.attname
+			) IS NOT NULL
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+		WHERE c.relkind IN ('r', 'p') AND c.oid <> ALL($1) AND `+userObject("c.oid")+`
+		ORDER BY 1, a.attnum
+	`, pq.Array(excluded), db.Namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := map[string][]SchemaColumn{}
+	names := []string{}
+	for rows.Next() {
+		var (
+			table                             string
+			column, kind, defaulted, identity sql.NullString
+			notNull, serial                   sql.NullBool
+		)
+		if err := rows.Scan(&table, &column, &kind, &notNull, &defaulted, &identity, &serial); err != nil {
+			return err
+		}
+		if _, ok := columns[table]; !ok {
+			names = append(names, table)
+			columns[table] = []SchemaColumn{}
+		}
+		if column.Valid {
+			c := SchemaColumn{
+				Name:     column.String,
+				Type:     kind.String,
+				NotNull:  notNull.Bool,
+				Default:  defaulted.String,
+				Identity: identity.String,
+			}
+			if serialType, ok := serialTypes[c.Type]; ok && serial.Bool {
+				// the sequence and its default come with the serial type
+				c.Type, c.Default = serialType, ""
+			}
+			columns[table] = append(columns[table], c)
+		}
+	}
+
+	for _, table := range names {
+		definitions := []string{}
+		for _, column := range columns[table] {
+			definitions = append(definitions, "    "+column.String())
+		}
+		*schema = append(*schema, SchemaObject{
+			Kind:       "table",
+			Name:       table,
+			Definition: fmt.Sprintf("CREATE TABLE %s (\n%s\n)", table, strings.Join(definitions, ",\n")),
+			Columns:    columns[table],
+		})
+	}
+	return rows.Err()
+}
+
+func (db DB) dumpConstraints(schema *Schema, excluded []int64) error {
+	rows, err := db.Query(`
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			quote_ident(con.conname), pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid <> ALL($1) AND `+userObject("c.oid"), pq.Array(excluded), db.Namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, name, definition string
+		if err := rows.Scan(&table, &name, &definition); err != nil {
+			return err
+		}
+		*schema = append(*schema, SchemaObject{
+			Kind:       "constraint",
+			Name:       table + "." + name,
+			Definition: fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", table, name, definition),
+			Table:      table,
+		})
+	}
+	return rows.Err()
+}
+
+func (db DB) dumpIndexes(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "index", `
+		SELECT quote_ident(n.nspname) || '.' || quote_ident(i.relname), pg_get_indexdef(i.oid)
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_namespace n ON n.oid = i.relnamespace
+		WHERE x.indrelid <> ALL($1)
+			-- indexes of primary keys, unique and exclusion constraints come
+			-- with the constraint
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = i.oid)
+			AND `+userObject("x.indrelid"), excluded)
+}
+
+func (db DB) dumpViews(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "view", `
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			CASE c.relkind WHEN 'm' THEN 'CREATE MATERIALIZED VIEW ' ELSE 'CREATE VIEW ' END
+				|| quote_ident(n.nspname) || '.' || quote_ident(c.relname) || ' AS' || E'\n'
+				|| pg_get_viewdef(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND c.oid <> ALL($1) AND `+userObject("c.oid"), excluded)
+}
+
+func (db DB) dumpFunctions(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "function", `
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(p.proname)
+				|| '(' || pg_get_function_identity_arguments(p.oid) || ')',
+			pg_get_functiondef(p.oid)
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.oid <> ALL($1)
+			AND NOT EXISTS (SELECT 1 FROM pg_aggregate g WHERE g.aggfnoid = p.oid)
+			AND `+userObject("p.oid"), excluded)
+}
+
+func (db DB) dumpSequences(schema *Schema, excluded []int64) error {
+	return db.dumpObjects(schema, "sequence", `
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			'CREATE SEQUENCE ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname)
+				|| ' AS ' || format_type(s.seqtypid, NULL)
+				|| ' INCREMENT BY ' || s.seqincrement
+				|| ' MINVALUE ' || s.seqmin || ' MAXVALUE ' || s.seqmax
+				|| ' START WITH ' || s.seqstart
+				|| CASE WHEN s.seqcycle THEN ' CYCLE' ELSE ' NO CYCLE' END
+		FROM pg_sequence s
+		JOIN pg_class c ON c.oid = s.seqrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		-- sequences of serial and identity columns come with their table
+		WHERE NOT EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.objid = c.oid AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		) AND c.oid <> ALL($1) AND `+userObject("c.oid"), excluded)
+}
+
+/*
+ * dumpObjects adds an object of kind for every name and definition returned
+ * by query.
+ */
+func (db DB) dumpObjects(schema *Schema, kind, query string, excluded []int64) error {
+	rows, err := db.Query(query, pq.Array(excluded), db.Namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		object := SchemaObject{Kind: kind}
+		if err := rows.Scan(&object.Name, &object.Definition); err != nil {
+			return err
+		}
+		*schema = append(*schema, object)
+	}
+	return rows.Err()
+}
+
+const (
+	objectAdded   = "added"
+	objectRemoved = "removed"
+	objectAltered = "altered"
+)
+
+/*
+ * SchemaChange is an object that differs between two schemas.
+ */
+type SchemaChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Diff   string `json:"diff"`
+}
+
+func (c SchemaChange) String() string {
+	return fmt.Sprintf("%s %s %s\n%s", c.Change, c.Kind, c.Name, c.Diff)
+}
+
+/*
+ * diffSchemas returns the objects that were added, removed or altered going
+ * from before to after.
+ */
+func diffSchemas(before, after Schema) []SchemaChange {
+	old := make(map[string]SchemaObject, len(before))
+	for _, object := range before {
+		old[object.key()] = object
+	}
+
+	changes := []SchemaChange{}
+	seen := map[string]bool{}
+	for _, object := range after {
+		seen[object.key()] = true
+		previous, ok := old[object.key()]
+		switch {
+		case !ok:
+			changes = append(changes, SchemaChange{object.Kind, object.Name, objectAdded,
+				diffLines("", object.Definition)})
+		case previous.Definition != object.Definition:
+			changes = append(changes, SchemaChange{object.Kind, object.Name, objectAltered,
+				diffLines(previous.Definition, object.Definition)})
+		}
+	}
+	for _, object := range before {
+		if !seen[object.key()] {
+			changes = append(changes, SchemaChange{object.Kind, object.Name, objectRemoved,
+				diffLines(object.Definition, "")})
+		}
+	}
+	return changes
+}
+
+/*
+ * diffLines returns a line diff of a and b with removed lines starting with
+ * "-" and added lines with "+".
+ */
+func diffLines(a, b string) string {
+	var x, y []string
+	if a != "" {
+		x = strings.Split(a, "\n")
+	}
+	if b != "" {
+		y = strings.Split(b, "\n")
+	}
+
+	// lcs[i][j] is the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			fmt.Fprintf(&out, "  %s\n", x[i])
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			fmt.Fprintf(&out, "+ %s\n", y[j])
+			j++
+		default:
+			fmt.Fprintf(&out, "- %s\n", x[i])
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diffLines(t *testing.T) {
+	assert.Equal(t, "  a\n- b\n+ c\n  d\n", diffLines("a\nb\nd", "a\nc\nd"))
+	assert.Equal(t, "+ a\n", diffLines("", "a"))
+	assert.Equal(t, "- a\n", diffLines("a", ""))
+}
+
+func Test_diffSchemas(t *testing.T) {
+	before := Schema{
+		{Kind: "table", Name: "public.a", Definition: "CREATE TABLE public.a (\n    id integer\n)"},
+		{Kind: "index", Name: "public.a_id", Definition: "CREATE INDEX a_id ON public.a USING btree (id)"},
+	}
+	after := Schema{
+		{Kind: "table", Name: "public.a", Definition: "CREATE TABLE public.a (\n    id integer,\n    b text\n)"},
+		{Kind: "view", Name: "public.v", Definition: "CREATE VIEW public.v AS\nSELECT 1"},
+	}
+
+	assert.Equal(t, []SchemaChange{
+		{"table", "public.a", objectAltered, "  CREATE TABLE public.a (\n-     id integer\n+     id integer,\n+     b text\n  )\n"},
+		{"view", "public.v", objectAdded, "+ CREATE VIEW public.v AS\n+ SELECT 1\n"},
+		{"index", "public.a_id", objectRemoved, "- CREATE INDEX a_id ON public.a USING btree (id)\n"},
+	}, diffSchemas(before, after))
+	assert.Empty(t, diffSchemas(before, before))
+}
+
+func Test_SchemaString(t *testing.T) {
+	schema := Schema{
+		{Kind: "index", Name: "public.a_id", Definition: "CREATE INDEX a_id ON public.a USING btree (id)"},
+		{Kind: "table", Name: "public.b", Definition: "CREATE TABLE public.b (\n)"},
+		{Kind: "table", Name: "public.a", Definition: "CREATE TABLE public.a (\n)"},
+	}
+	schema.sort()
+	assert.Equal(t, "-- table public.a\nCREATE TABLE public.a (\n);\n\n"+
+		"-- table public.b\nCREATE TABLE public.b (\n);\n\n"+
+		"-- index public.a_id\nCREATE INDEX a_id ON public.a USING btree (id);\n\n", schema.String())
+}
+
+func Test_withDatabaseName(t *testing.T) {
+	url, err := withDatabaseName("postgres://u:p@localhost:5432/app?sslmode=disable", "scratch")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://u:p@localhost:5432/scratch?sslmode=disable", url)
+
+	dsn, err := withDatabaseName("host=localhost dbname=app", "scratch")
+	assert.NoError(t, err)
+	assert.Equal(t, "host=localhost dbname=app dbname='scratch'", dsn)
+}
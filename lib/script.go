@@ -2,11 +2,18 @@ package lib
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
 )
 
 /*
@@ -30,8 +37,22 @@ type Script struct {
 
 	Author    string
 	direction int
+
+	// Timeouts and Transaction come from the migration's metadata and take
+	// precedence over the global settings in .goose.yaml
+	Timeouts    Timeouts
+	Transaction string
 }
 
+const (
+	// transactionNone leaves transaction handling to the script itself
+	transactionNone = "none"
+
+	// transactionSingle runs the script and its goosey bookkeeping in one
+	// transaction opened by goose
+	transactionSingle = "single"
+)
+
 /*
  * Execute runs a single migration script against the database.  If we are
  * executing an up script each script will have a row added to the goosey table
@@ -41,28 +62,147 @@ type Script struct {
  * If we execute a down script, its corresponding row from the goosey table
  * will be removed.  If this is the last down script in the batch then the last
  * row in the goosey table will have its marker set to true.
+ *
+ * A script that fails only because it could not get a lock within the lock
+ * timeout is retried with exponential backoff up to lock_retry_attempts times.
+ * Failing to record a script is never retried, the script may have committed.
  */
 func (s Script) Execute(db *DB) error {
-	script, err := ioutil.ReadFile(s.Path)
+	script, err := s.Render(db)
 	if err != nil {
 		return err
 	}
 
-	err = db.RunScript(string(script))
+	mode, err := s.transactionMode()
+	if err != nil {
+		return err
+	}
+
+	attempts := viper.GetInt("lock_retry_attempts")
+	backoff := viper.GetDuration("lock_retry_backoff")
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = db.ApplyScript(s, script, mode, s.settings())
+		if err == nil || !retryable(err) || attempt >= attempts {
+			break
+		}
+		progress(red, "%slock timeout on attempt %d of %d for %s, retrying in %s\n",
+			db.label(), attempt, attempts, s.Path, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("execute script %s %s: %s", s.Hash, s.Path, err)
+	}
+	return nil
+}
+
+/*
+ * ScriptValues are what a migration script can use in its placeholders.
+ */
+type ScriptValues struct {
+	// Vars come from the vars of .goose.yaml, its selected environment and
+	// the target
+	Vars map[string]string
+
+	// Schema is the first schema in the search path of the database
+	Schema string
+}
+
+// scriptActionRegex finds the placeholders that make a script a template, so
+// scripts with other uses of {{, like array literals, are sent as they are
+var scriptActionRegex = regexp.MustCompile(`\{\{-?\s*\.(Vars|Schema)\b`)
+
+/*
+ * Render reads the script and substitutes the values of db into its
+ * placeholders.  Variables the script uses but db doesn't have are an error.
+ */
+func (s Script) Render(db *DB) (string, error) {
+	script, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+	if !scriptActionRegex.Match(script) {
+		return string(script), nil
+	}
+
+	values := ScriptValues{Vars: db.Vars}
+	if err := db.QueryRow(`SELECT COALESCE(current_schema(), '')`).Scan(&values.Schema); err != nil {
+		return "", err
+	}
+	return renderScript(s.Path, string(script), values)
+}
+
+func renderScript(path, script string, values ScriptValues) (string, error) {
+	t, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(script)
 	if err != nil {
-		// if there was a transaction and it failed then we need to rollback
-		db.RunScript(`rollback`)
-		//if !isErrorAcceptable(s.Path, err) {
-		//    return fmt.Errorf("err: execute script %s %s: %s", s.Hash, s.Path, err)
-		//}
+		return "", fmt.Errorf("%s: %s", path, err)
 	}
+	var b strings.Builder
+	if err := t.Execute(&b, values); err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	return b.String(), nil
+}
 
-	if s.direction == Up {
-		err = db.InsertLastMigration(s)
-	} else {
-		err = db.DeleteLastMigration(s.Hash)
+/*
+ * settings returns the postgres settings applied before the script runs.  The
+ * migration's own timeouts win over the global ones.
+ */
+func (s Script) settings() map[string]string {
+	settings := map[string]string{}
+	for name, value := range map[string]string{
+		"lock_timeout":      s.Timeouts.Lock,
+		"statement_timeout": s.Timeouts.Statement,
+	} {
+		if value == "" {
+			value = viper.GetString(name)
+		}
+		if value != "" {
+			settings[name] = value
+		}
 	}
-	return err
+	return settings
+}
+
+/*
+ * directory returns the name of the migration directory of the script.
+ */
+func (s Script) directory() string {
+	return filepath.Base(filepath.Dir(s.Path))
+}
+
+func (s Script) transactionMode() (string, error) {
+	mode := s.Transaction
+	if mode == "" {
+		mode = viper.GetString("transaction")
+	}
+	switch mode {
+	case "", transactionNone:
+		return transactionNone, nil
+	case transactionSingle:
+		return transactionSingle, nil
+	}
+	return "", fmt.Errorf("unknown transaction mode %s for %s", mode, s.Path)
+}
+
+/*
+ * isLockTimeout reports if err was caused by lock_timeout expiring.
+ */
+func isLockTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "55P03"
+}
+
+/*
+ * retryable reports if err is a lock timeout of the script's own statements.
+ */
+func retryable(err error) bool {
+	var script scriptError
+	return errors.As(err, &script) && isLockTimeout(err)
 }
 
 func isErrorAcceptable(file string, err error) bool {
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var renderScriptTests = []struct {
+	name     string
+	script   string
+	expected string
+	hasErr   bool
+}{
+	{
+		"vars",
+		"GRANT SELECT ON users TO {{ .Vars.app_role }};",
+		"GRANT SELECT ON users TO app;",
+		false,
+	},
+	{
+		"schema",
+		"CREATE TABLE {{.Schema}}.users ();",
+		"CREATE TABLE tenant_1.users ();",
+		false,
+	},
+	{
+		"several",
+		"ALTER TABLE users SET TABLESPACE {{ .Vars.tablespace }}; -- {{ .Vars.tablespace }}",
+		"ALTER TABLE users SET TABLESPACE fast; -- fast",
+		false,
+	},
+	{
+		"missing variable",
+		"GRANT SELECT ON users TO {{ .Vars.replication_user }};",
+		"",
+		true,
+	},
+}
+
+func Test_renderScript(t *testing.T) {
+	values := ScriptValues{
+		Vars:   map[string]string{"app_role": "app", "tablespace": "fast"},
+		Schema: "tenant_1",
+	}
+	for _, tt := range renderScriptTests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, err := renderScript("up.sql", tt.script, values)
+			if tt.hasErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, sql)
+		})
+	}
+}
+
+func Test_scriptActionRegex(t *testing.T) {
+	assert.True(t, scriptActionRegex.MatchString("TO {{ .Vars.app_role }}"))
+	assert.True(t, scriptActionRegex.MatchString("TO {{- .Schema -}}"))
+	assert.False(t, scriptActionRegex.MatchString("SELECT '{{1,2},{3,4}}'::int[][]"))
+	assert.False(t, scriptActionRegex.MatchString("SELECT '{{ .Variables }}'"))
+}
+
+var settingsTests = []struct {
+	name     string
+	global   map[string]string
+	timeouts Timeouts
+	expected map[string]string
+}{
+	{"none", nil, Timeouts{}, map[string]string{}},
+	{
+		"global",
+		map[string]string{"lock_timeout": "5s", "statement_timeout": "1min"},
+		Timeouts{},
+		map[string]string{"lock_timeout": "5s", "statement_timeout": "1min"},
+	},
+	{
+		"migration wins",
+		map[string]string{"lock_timeout": "5s", "statement_timeout": "1min"},
+		Timeouts{Lock: "1s"},
+		map[string]string{"lock_timeout": "1s", "statement_timeout": "1min"},
+	},
+	{
+		"migration only",
+		nil,
+		Timeouts{Statement: "10min"},
+		map[string]string{"statement_timeout": "10min"},
+	},
+}
+
+func Test_settings(t *testing.T) {
+	for _, tt := range settingsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer viper.Reset()
+			for name, value := range tt.global {
+				viper.Set(name, value)
+			}
+			assert.Equal(t, tt.expected, Script{Timeouts: tt.timeouts}.settings())
+		})
+	}
+}
+
+var transactionModeTests = []struct {
+	global    string
+	migration string
+	expected  string
+	hasErr    bool
+}{
+	{"", "", transactionNone, false},
+	{"single", "", transactionSingle, false},
+	{"single", "none", transactionNone, false},
+	{"", "single", transactionSingle, false},
+	{"", "nested", "", true},
+	{"always", "", "", true},
+}
+
+func Test_transactionMode(t *testing.T) {
+	for _, tt := range transactionModeTests {
+		t.Run(tt.global+"/"+tt.migration, func(t *testing.T) {
+			defer viper.Reset()
+			viper.Set("transaction", tt.global)
+			mode, err := Script{Transaction: tt.migration}.transactionMode()
+			if tt.hasErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+}
+
+var lockTimeout = &pq.Error{Code: "55P03", Message: "canceling statement due to lock timeout"}
+
+var lockTimeoutTests = []struct {
+	name        string
+	err         error
+	lockTimeout bool
+	retryable   bool
+}{
+	{"lock timeout of the script", scriptError{lockTimeout}, true, true},
+	{"wrapped", fmt.Errorf("up: %w", scriptError{lockTimeout}), true, true},
+	{"lock timeout recording the script", lockTimeout, true, false},
+	{"statement timeout", scriptError{&pq.Error{Code: "57014"}}, false, false},
+	{"other error", scriptError{errors.New("syntax error")}, false, false},
+}
+
+func Test_isLockTimeout(t *testing.T) {
+	for _, tt := range lockTimeoutTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.lockTimeout, isLockTimeout(tt.err))
+			assert.Equal(t, tt.retryable, retryable(tt.err))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+const snapshotHeader = "-- Schema snapshot written by goose. Do not edit, it is replaced after every run.\n\n"
+
+/*
+ * snapshotPath returns where the schema snapshot is written, relative to the
+ * migration repository unless it is absolute.  It is empty when snapshots are
+ * turned off.
+ */
+func snapshotPath() string {
+	path := viper.GetString("snapshot")
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(viper.GetString("migration-repository"), path)
+}
+
+/*
+ * writeSnapshot replaces the snapshot file with schema when a snapshot path
+ * is configured.
+ */
+func writeSnapshot(schema Schema) error {
+	path := snapshotPath()
+	if path == "" {
+		return nil
+	}
+	if err := ioutil.WriteFile(path, []byte(snapshotHeader+schema.String()), 0644); err != nil {
+		return fmt.Errorf("snapshot schema: %s", err)
+	}
+	return nil
+}
+
+/*
+ * afterRun records the schema fingerprint and writes the snapshot after the
+ * migrations of a run.  A failed run records the schema left behind by the
+ * migrations that did run, unless it failed before any of them, e.g. on
+ * drift.  The error of the run is returned first.  A dry run changed nothing
+ * to record.
+ */
+func afterRun(db *DB, results []MigrationResult, runErr error) error {
+	if dryRun || (runErr != nil && !ranScripts(results)) {
+		return runErr
+	}
+	schema, err := recordFingerprint(db)
+	if err == nil {
+		err = writeSnapshot(schema)
+	}
+	if runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+/*
+ * ranScripts reports if a script of the results ran without failing.
+ */
+func ranScripts(results []MigrationResult) bool {
+	for _, result := range results {
+		if result.Error == "" && result.Direction != "skip" {
+			return true
+		}
+	}
+	return false
+}
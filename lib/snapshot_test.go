@@ -0,0 +1,27 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_snapshotPath(t *testing.T) {
+	defer viper.Reset()
+
+	assert.Equal(t, "", snapshotPath())
+
+	viper.Set("migration-repository", "/repo")
+	viper.Set("snapshot", "schema.sql")
+	assert.Equal(t, "/repo/schema.sql", snapshotPath())
+
+	viper.Set("snapshot", "/tmp/schema.sql")
+	assert.Equal(t, "/tmp/schema.sql", snapshotPath())
+}
+
+func Test_ranScripts(t *testing.T) {
+	assert.False(t, ranScripts(nil), "failed before any migration, e.g. on drift")
+	assert.False(t, ranScripts([]MigrationResult{{Direction: "skip"}, {Direction: "up", Error: "syntax error"}}))
+	assert.True(t, ranScripts([]MigrationResult{{Direction: "up"}, {Direction: "up", Error: "syntax error"}}))
+}
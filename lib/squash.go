@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * applySquashes replaces the migrations squashed into a baseline with the
+ * baseline, which takes the place of the first of them.  Migrations whose
+ * directories were deleted are left out.
+ */
+func (migrations Migrations) applySquashes() Migrations {
+	baselines := map[string]*Migration{}
+	for _, migration := range migrations {
+		for _, squashed := range migration.Metadata.Squashes {
+			baselines[squashed.Hash] = migration
+		}
+	}
+
+	placed := map[*Migration]bool{}
+	result := Migrations{}
+	for _, migration := range migrations {
+		baseline, ok := baselines[migration.Hash]
+		if !ok {
+			if !placed[migration] && !migration.deleted {
+				result = append(result, migration)
+				placed[migration] = true
+			}
+			continue
+		}
+		if !placed[baseline] {
+			result = append(result, baseline)
+			placed[baseline] = true
+		}
+	}
+
+	squashedPaths := map[string]string{}
+	for hash, baseline := range baselines {
+		for _, squashed := range baseline.Metadata.Squashes {
+			if squashed.Hash == hash {
+				squashedPaths[filepath.Base(squashed.Path)] = baseline.Path
+			}
+		}
+	}
+	for index, migration := range result {
+		migration.Index = index
+		// dependencies on squashed migrations are met by the baseline
+		for i, dependency := range migration.Metadata.DependsOn {
+			if path, ok := squashedPaths[filepath.Base(dependency)]; ok {
+				migration.Metadata.DependsOn[i] = path
+			}
+		}
+	}
+	return result
+}
+
+/*
+ * resolveSquashed returns the hash of the baseline that stands for hash when
+ * hash is the last migration squashed into it.  A database that stopped part
+ * way through the squashed migrations, or skipped one of them, can't be
+ * migrated with the baseline.
+ */
+func (migrations Migrations) resolveSquashed(hash string, skipped map[string]bool) (string, error) {
+	for _, migration := range migrations {
+		squashes := migration.Metadata.Squashes
+		for i, squashed := range squashes {
+			if squashed.Hash != hash {
+				continue
+			}
+			if i < len(squashes)-1 {
+				return "", partialSquash(squashes[i+1], migration)
+			}
+			for _, squashed := range squashes {
+				if skipped[squashed.Hash] {
+					return "", partialSquash(squashed, migration)
+				}
+			}
+			return migration.Hash, nil
+		}
+	}
+	return hash, nil
+}
+
+func partialSquash(missing Squashed, baseline *Migration) error {
+	return fmt.Errorf(
+		"the database hasn't applied %s, one of the migrations squashed into %s; "+
+			"apply the rest with a checkout from before the squash",
+		missing.Path, baseline.Path)
+}
+
+/*
+ * isBaseline reports if the migration stands for squashed migrations.
+ */
+func (migration Migration) isBaseline() bool {
+	return len(migration.Metadata.Squashes) > 0
+}
+
+/*
+ * migrationsBefore returns the migrations that come before before, which is
+ * a migration selector or a date.  With a date the migrations merged before
+ * it are returned.
+ */
+func migrationsBefore(migrations Migrations, before string) (Migrations, error) {
+	if date, ok := parseDate(before); ok {
+		for i, migration := range migrations {
+			if !migration.MergedDate.Before(date) {
+				return migrations[:i], nil
+			}
+		}
+		return migrations, nil
+	}
+
+	migration, err := migrations.Find(before)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range migrations {
+		if m == migration {
+			return migrations[:i], nil
+		}
+	}
+	return nil, fmt.Errorf("no migration matches %s", before)
+}
+
+/*
+ * parseDate parses a day or an RFC 3339 time.
+ */
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339Nano} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+/*
+ * Squash applies the migrations to a new scratch database and writes a
+ * baseline migration with its schema into a new directory in the migration
+ * directory.  The baseline lists the hashes it stands for, so databases that
+ * applied all of them treat the baseline as applied.
+ */
+func Squash(migrations Migrations, directory string) (string, error) {
+	scratch, cleanup, err := openScratch("template0")
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	if err := scratch.EnsureGoosey(); err != nil {
+		return "", err
+	}
+	batch := batchHash()
+	squashes := []Squashed{}
+	for _, migration := range migrations {
+		progress(green, "%s↑ %s\n", scratch.label(), migration.Path)
+		up := migration.Up
+		up.Batch = batch
+		if err := up.Execute(scratch); err != nil {
+			return "", err
+		}
+		squashes = append(squashes, migration.Metadata.Squashes...)
+		squashes = append(squashes, Squashed{Hash: migration.Hash, Path: migration.Path})
+	}
+
+	schema, err := scratch.DumpSchema()
+	if err != nil {
+		return "", err
+	}
+	if err := verifyBaseline(schema); err != nil {
+		return "", err
+	}
+	return writeBaseline(directory, "goose_squash_baseline", schema, Metadata{
+		Description: fmt.Sprintf("Baseline of the %d migrations up to %s",
+			len(migrations), migrations[len(migrations)-1].Path),
+		Tags:     []string{"baseline"},
+		Squashes: squashes,
+	})
+}
+
+/*
+ * verifyBaseline applies the up script of a baseline of schema to a second
+ * scratch database and fails unless it creates the same schema.
+ */
+func verifyBaseline(schema Schema) error {
+	scratch, cleanup, err := openScratch("template0")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := scratch.Exec(migrationDDL(Schema{}, schema)); err != nil {
+		return fmt.Errorf("apply the baseline to a scratch database: %s", err)
+	}
+	created, err := scratch.DumpSchema()
+	if err != nil {
+		return err
+	}
+	changes := diffSchemas(schema, created)
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, change := range changes {
+		progress(yellow, "%s%s %s %s\n", scratch.label(), change.Change, change.Kind, change.Name)
+	}
+	return fmt.Errorf("the baseline doesn't create the schema of the squashed migrations, it differs in %d places", len(changes))
+}
+
+/*
+ * writeBaseline writes a migration that creates schema from nothing into a
+ * new timestamped directory named after name.
+ */
+func writeBaseline(directory, name string, schema Schema, metadata Metadata) (string, error) {
+	name, err := namingScheme().NewName(directory, Author{Name: "goose"}, name)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(directory, name)
+	if err := os.Mkdir(path, 0777); err != nil {
+		return "", err
+	}
+
+	header := fmt.Sprintf("-- %s\n\n", metadata.Description)
+	files := map[string]string{
+		"up.sql":   header + migrationDDL(Schema{}, schema),
+		"down.sql": header + migrationDDL(schema, Schema{}),
+	}
+	data, err := yaml.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	files[metadataFile] = string(data)
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(path, name), []byte(content), 0666); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
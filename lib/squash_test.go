@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func squashFixture() Migrations {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &Migration{Hash: "a", Path: "20200101_120000_a_a_a", MergedDate: date}
+	b := &Migration{Hash: "b", Path: "20200102_120000_b_b_b", MergedDate: date.AddDate(0, 0, 1), deleted: true}
+	c := &Migration{Hash: "c", Path: "20200103_120000_c_c_c", MergedDate: date.AddDate(0, 0, 2),
+		Metadata: Metadata{DependsOn: []string{"20200102_120000_b_b_b"}}}
+	baseline := &Migration{Hash: "x", Path: "20200104_120000_goose_squash_baseline", MergedDate: date.AddDate(0, 0, 3),
+		Metadata: Metadata{Squashes: []Squashed{{"a", a.Path}, {"b", b.Path}}}}
+	d := &Migration{Hash: "d", Path: "20200105_120000_d_d_d", MergedDate: date.AddDate(0, 0, 4), deleted: true}
+	return Migrations{a, b, c, baseline, d}
+}
+
+func Test_applySquashes(t *testing.T) {
+	migrations := squashFixture().applySquashes()
+
+	paths := []string{}
+	for _, migration := range migrations {
+		paths = append(paths, migration.Path)
+	}
+	assert.Equal(t, []string{"20200104_120000_goose_squash_baseline", "20200103_120000_c_c_c"}, paths)
+	assert.Equal(t, []string{"20200104_120000_goose_squash_baseline"}, migrations[1].Metadata.DependsOn)
+}
+
+func Test_resolveSquashed(t *testing.T) {
+	migrations := squashFixture().applySquashes()
+
+	hash, err := migrations.resolveSquashed("b", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", hash)
+
+	hash, err = migrations.resolveSquashed("c", map[string]bool{"a": true})
+	assert.NoError(t, err)
+	assert.Equal(t, "c", hash)
+
+	_, err = migrations.resolveSquashed("a", nil)
+	assert.EqualError(t, err, "the database hasn't applied 20200102_120000_b_b_b, one of the migrations "+
+		"squashed into 20200104_120000_goose_squash_baseline; apply the rest with a checkout from before the squash")
+
+	_, err = migrations.resolveSquashed("b", map[string]bool{"a": true})
+	assert.EqualError(t, err, "the database hasn't applied 20200101_120000_a_a_a, one of the migrations "+
+		"squashed into 20200104_120000_goose_squash_baseline; apply the rest with a checkout from before the squash")
+}
+
+func Test_migrationsBefore(t *testing.T) {
+	migrations := squashFixture()[:3]
+
+	before, err := migrationsBefore(migrations, "c")
+	assert.NoError(t, err)
+	assert.Len(t, before, 2)
+
+	before, err = migrationsBefore(migrations, "2020-01-02")
+	assert.NoError(t, err)
+	assert.Len(t, before, 1)
+
+	_, err = migrationsBefore(migrations, "nothing")
+	assert.Error(t, err)
+}
+
+func Test_CheckRollbackBaseline(t *testing.T) {
+	migrations := squashFixture().applySquashes()
+	assert.Error(t, CheckRollback(migrations, migrations[:1]))
+	assert.NoError(t, CheckRollback(migrations, migrations[1:]))
+}
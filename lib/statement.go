@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	dollarTagRegex  = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+	ignoreRegex     = regexp.MustCompile(`goose:ignore\s+([A-Za-z0-9_,\s-]+)`)
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+	quotedValue     = "''"
+)
+
+/*
+ * Statement is a single SQL statement of a script.
+ */
+type Statement struct {
+	// Text is the statement with comments removed, string literals and
+	// dollar quoted bodies emptied and whitespace collapsed, so it can be
+	// matched without tripping over quoted SQL
+	Text string
+
+	// Line is the line the statement starts on
+	Line int
+
+	// Ignored are the rules suppressed with a -- goose:ignore comment
+	Ignored map[string]bool
+}
+
+/*
+ * splitStatements splits a script into its statements.  A -- goose:ignore
+ * comment belongs to the statement it is in front of, or to the statement it
+ * follows on the same line.
+ */
+func splitStatements(sql string) []Statement {
+	statements := []Statement{}
+	current := Statement{Ignored: map[string]bool{}}
+	var text strings.Builder
+	line, endLine := 1, 0
+
+	finish := func() {
+		current.Text = strings.TrimSpace(whitespaceRegex.ReplaceAllString(text.String(), " "))
+		if current.Text != "" {
+			statements = append(statements, current)
+			endLine = line
+		}
+		current = Statement{Ignored: map[string]bool{}}
+		text.Reset()
+	}
+	write := func(s string) {
+		if current.Line == 0 && strings.TrimSpace(s) != "" {
+			current.Line = line
+		}
+		text.WriteString(s)
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		rest := sql[i:]
+		switch {
+		case c == '\n':
+			line++
+			text.WriteByte(' ')
+
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			ignored := current.Ignored
+			if strings.TrimSpace(text.String()) == "" && endLine == line && len(statements) > 0 {
+				ignored = statements[len(statements)-1].Ignored
+			}
+			if match := ignoreRegex.FindStringSubmatch(rest[:end]); match != nil {
+				for _, rule := range strings.FieldsFunc(match[1], func(r rune) bool {
+					return r == ',' || r == ' ' || r == '\t'
+				}) {
+					ignored[rule] = true
+				}
+			}
+			i += end - 1
+
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			line += strings.Count(rest[:end+2], "\n")
+			text.WriteByte(' ')
+			i += end + 3
+
+		case c == '\'' || c == '"':
+			end := closingQuote(rest, c)
+			line += strings.Count(rest[:end], "\n")
+			if c == '\'' {
+				write(quotedValue)
+			} else {
+				write(rest[:end])
+			}
+			i += end - 1
+
+		case c == '$' && dollarTagRegex.MatchString(rest):
+			tag := dollarTagRegex.FindString(rest)
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				end = len(rest) - 2*len(tag)
+			}
+			body := len(tag) + end + len(tag)
+			line += strings.Count(rest[:body], "\n")
+			write(quotedValue)
+			i += body - 1
+
+		case c == ';':
+			finish()
+
+		default:
+			write(string(c))
+		}
+	}
+	finish()
+	return statements
+}
+
+/*
+ * closingQuote returns the length of the quoted text at the start of s,
+ * including both quotes.  Doubled quotes are escapes.
+ */
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(s)
+}
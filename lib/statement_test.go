@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var splitStatementsTests = []struct {
+	name     string
+	sql      string
+	expected []Statement
+}{
+	{
+		"two statements",
+		"create table a (id int);\n\ncreate table b (id int);",
+		[]Statement{
+			{"create table a (id int)", 1, map[string]bool{}},
+			{"create table b (id int)", 3, map[string]bool{}},
+		},
+	},
+	{
+		"quotes and comments",
+		"-- a comment; with a semicolon\ninsert into a values ('x;y', \"q;\") /* ; */;",
+		[]Statement{
+			{`insert into a values ('', "q;")`, 2, map[string]bool{}},
+		},
+	},
+	{
+		"dollar quotes",
+		"create function f() returns int as $body$\nbegin; return 1; end;\n$body$ language plpgsql;\nselect 1;",
+		[]Statement{
+			{"create function f() returns int as '' language plpgsql", 1, map[string]bool{}},
+			{"select 1", 4, map[string]bool{}},
+		},
+	},
+	{
+		"ignore before",
+		"-- goose:ignore rename, drop-table\nalter table a rename to b;",
+		[]Statement{
+			{"alter table a rename to b", 2, map[string]bool{"rename": true, "drop-table": true}},
+		},
+	},
+	{
+		"ignore after on the same line",
+		"drop table a; -- goose:ignore drop-table\ndrop table b;",
+		[]Statement{
+			{"drop table a", 1, map[string]bool{"drop-table": true}},
+			{"drop table b", 2, map[string]bool{}},
+		},
+	},
+}
+
+func Test_splitStatements(t *testing.T) {
+	for _, tt := range splitStatementsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, splitStatements(tt.sql))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// targetsFile is the file given with --targets
+var targetsFile string
+
+// concurrency is the number of targets migrated at the same time
+var concurrency int
+
+/*
+ * Target is one of several databases that are migrated in a single run.  Each
+ * target keeps its own goosey table.
+ */
+type Target struct {
+	Name        string `mapstructure:"name"`
+	DatabaseURL string `mapstructure:"database-url"`
+	Schema      string `mapstructure:"schema"`
+	Table       string `mapstructure:"table"`
+
+	// SearchPath is set on every connection when the target is a schema
+	SearchPath string `mapstructure:"search-path"`
+
+	// Vars override the vars in .goose.yaml for the scripts run on the target
+	Vars map[string]string `mapstructure:"vars"`
+}
+
+/*
+ * TargetResult is the outcome of migrating a single target.
+ */
+type TargetResult struct {
+	Target     Target
+	Count      int
+	Duration   time.Duration
+	Migrations []MigrationResult
+	Err        error
+}
+
+/*
+ * loadTargets returns the targets listed in the --targets file, or else the
+ * targets list in .goose.yaml.
+ */
+func loadTargets() ([]Target, error) {
+	v := viper.GetViper()
+	if targetsFile != "" {
+		v = viper.New()
+		v.SetConfigFile(targetsFile)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("can not read targets file %s: %s", targetsFile, err)
+		}
+	}
+
+	targets := []Target{}
+	if err := v.UnmarshalKey("targets", &targets); err != nil {
+		return nil, err
+	}
+	for i, target := range targets {
+		if target.Name == "" {
+			targets[i].Name = redactURL(target.DatabaseURL)
+		}
+	}
+	return targets, nil
+}
+
+/*
+ * runTargets connects to every target and calls migrate with it, running at
+ * most concurrency targets at the same time.  migrate fills in the count and
+ * migrations of the target's result.
+ */
+func runTargets(targets []Target, concurrency int, migrate func(*DB, *TargetResult) error) []TargetResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]TargetResult, len(targets))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			start := time.Now()
+			result := TargetResult{Target: target}
+			db, err := OpenDatabase(target)
+			if err == nil {
+				err = migrate(db, &result)
+				db.Close()
+			}
+			result.Err = err
+			result.Duration = time.Since(start)
+			results[i] = result
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+/*
+ * printTargetResults prints a summary table of the results, or a json
+ * document in json mode, and returns an error if any target failed.
+ */
+func printTargetResults(command string, results []TargetResult) error {
+	documents := targetDocuments(results)
+
+	failed := 0
+	for _, document := range documents {
+		if document.Error != "" {
+			failed++
+		}
+	}
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d targets failed", failed, len(results))
+	}
+
+	if jsonOutput() {
+		document := RunDocument{
+			Command:    command,
+			Migrations: []MigrationResult{},
+			Targets:    documents,
+		}
+		if err != nil {
+			document.Error = err.Error()
+		}
+		if printErr := printJSON(document); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tRESULT\tMIGRATIONS\tDURATION\tERROR")
+	for _, document := range documents {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%dms\t%s\n",
+			document.Target, document.Result, document.Count,
+			document.DurationMS, document.Error)
+	}
+	w.Flush()
+	return err
+}
+
+func targetDocuments(results []TargetResult) []TargetDocument {
+	documents := []TargetDocument{}
+	for _, result := range results {
+		document := TargetDocument{
+			Target:     result.Target.Name,
+			Result:     "ok",
+			Count:      result.Count,
+			DurationMS: result.Duration.Milliseconds(),
+			Migrations: result.Migrations,
+		}
+		if result.Err != nil {
+			document.Result = "failed"
+			document.Error = mask(result.Err.Error())
+		}
+		documents = append(documents, document)
+	}
+	return documents
+}
@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// templateDirectory is the directory of the migration repository that holds
+// a directory of files for each template
+const templateDirectory = "templates"
+
+/*
+ * Values are what a template can use to render the files of a new migration.
+ */
+type Values struct {
+	Migration string
+	Author    string
+	Email     string
+	Directory string
+	Timestamp string
+
+	// Vars are the user defined variables given with --var
+	Vars map[string]string
+}
+
+/*
+ * Template renders the files of a new migration.  Files maps the name of
+ * each file, e.g. up.sql or verify.sql, to its text/template source.
+ */
+type Template struct {
+	Name   string            `json:"name"`
+	Source string            `json:"source"`
+	Files  map[string]string `json:"files"`
+}
+
+/*
+ * fileNames returns the names of the files of the template in order.
+ */
+func (t Template) fileNames() []string {
+	names := make([]string, 0, len(t.Files))
+	for name := range t.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+ * check returns an error if the template can't make a migration.
+ */
+func (t Template) check() error {
+	for _, name := range []string{"up.sql", "down.sql"} {
+		if _, ok := t.Files[name]; !ok {
+			return fmt.Errorf("template %s has no %s", t.Name, name)
+		}
+	}
+	return nil
+}
+
+/*
+ * Render renders every file of the template with values.  Variables used by
+ * the template but not given are an error.
+ */
+func (t Template) Render(values Values) (map[string]string, error) {
+	return t.render(values, "missingkey=error")
+}
+
+/*
+ * render renders every file of the template with values and the given
+ * text/template option.
+ */
+func (t Template) render(values Values, option string) (map[string]string, error) {
+	rendered := make(map[string]string, len(t.Files))
+	for _, name := range t.fileNames() {
+		tmpl, err := template.New(name).Option(option).Parse(t.Files[name])
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s", t.Name, err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, values); err != nil {
+			return nil, fmt.Errorf("template %s: %s", t.Name, err)
+		}
+		rendered[name] = b.String()
+	}
+	return rendered, nil
+}
+
+/*
+ * loadTemplates returns the templates in the templates section of .goose.yaml
+ * and in the templates directory of the migration repository.  A template
+ * directory wins over a template of the same name in .goose.yaml.
+ */
+func loadTemplates() (map[string]Template, error) {
+	templates := map[string]Template{}
+	for name, value := range viper.GetStringMap("templates") {
+		files, err := configTemplateFiles(value)
+		if err != nil {
+			return nil, fmt.Errorf("templates.%s: %s", name, err)
+		}
+		templates[name] = Template{Name: name, Source: ".goose.yaml", Files: files}
+	}
+
+	dir := filepath.Join(viper.GetString("migration-repository"), templateDirectory)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		files, err := readTemplateFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		templates[entry.Name()] = Template{Name: entry.Name(), Source: path, Files: files}
+	}
+	return templates, nil
+}
+
+/*
+ * configTemplateFiles returns the files of a template in .goose.yaml.  The up
+ * and down keys stand for up.sql and down.sql, every other key is the name of
+ * a file.
+ */
+func configTemplateFiles(value interface{}) (map[string]string, error) {
+	scripts, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a file name for each script")
+	}
+	files := make(map[string]string, len(scripts))
+	for name, text := range scripts {
+		if name == "up" || name == "down" {
+			name += ".sql"
+		}
+		source, err := cast.ToStringE(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not text", name)
+		}
+		files[name] = source
+	}
+	return files, nil
+}
+
+/*
+ * readTemplateFiles reads every file in the template directory at path.
+ */
+func readTemplateFiles(path string) (map[string]string, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		source, err := ioutil.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = string(source)
+	}
+	return files, nil
+}
+
+/*
+ * findTemplate returns the template called name.
+ */
+func findTemplate(name string) (Template, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return Template{}, err
+	}
+	t, ok := templates[name]
+	if !ok {
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return Template{}, fmt.Errorf("unknown template %s, no templates are defined", name)
+		}
+		return Template{}, fmt.Errorf("unknown template %s, use one of %s", name, strings.Join(names, ", "))
+	}
+	return t, t.check()
+}
+
+/*
+ * parseVars parses the key=value pairs given with --var.
+ */
+func parseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid variable %s, expected key=value", pair)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+/*
+ * writeMigrationFiles writes files into the new migration directory.
+ */
+func writeMigrationFiles(directory string, files map[string]string) error {
+	if err := os.Mkdir(directory, 0777); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var parseVarsTests = []struct {
+	pairs    []string
+	expected map[string]string
+	hasErr   bool
+}{
+	{nil, map[string]string{}, false},
+	{[]string{"table=users", "owner=app"}, map[string]string{"table": "users", "owner": "app"}, false},
+	{[]string{"where=a=b"}, map[string]string{"where": "a=b"}, false},
+	{[]string{"empty="}, map[string]string{"empty": ""}, false},
+	{[]string{"table"}, nil, true},
+	{[]string{"=users"}, nil, true},
+}
+
+func Test_parseVars(t *testing.T) {
+	for _, tt := range parseVarsTests {
+		vars, err := parseVars(tt.pairs)
+		if tt.hasErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, vars)
+	}
+}
+
+func Test_loadTemplates(t *testing.T) {
+	repo, err := ioutil.TempDir(os.TempDir(), "goosey-templates-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+	defer viper.Reset()
+
+	write := func(name, file, content string) {
+		path := filepath.Join(repo, templateDirectory, name)
+		assert.NoError(t, os.MkdirAll(path, 0777))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(path, file), []byte(content), 0666))
+	}
+	write("table", "up.sql", "CREATE TABLE {{ .Vars.table }} ();")
+	write("table", "down.sql", "DROP TABLE {{ .Vars.table }};")
+	write("table", "verify.sql", "SELECT 1 FROM {{ .Vars.table }};")
+	write("data", "up.sql", "-- from the directory")
+	write("broken", "up.sql", "")
+
+	viper.Set("migration-repository", repo)
+	viper.Set("templates", map[string]interface{}{
+		"schema": map[string]interface{}{"up": "BEGIN;", "down": "COMMIT;", "migration.yaml": "tags: [schema]"},
+		"data":   map[string]interface{}{"up": "-- from .goose.yaml", "down": ""},
+	})
+
+	templates, err := loadTemplates()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"down.sql", "migration.yaml", "up.sql"}, templates["schema"].fileNames())
+	assert.Equal(t, "-- from the directory", templates["data"].Files["up.sql"])
+
+	table, err := findTemplate("table")
+	assert.NoError(t, err)
+	files, err := table.Render(Values{Vars: map[string]string{"table": "users"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"up.sql":     "CREATE TABLE users ();",
+		"down.sql":   "DROP TABLE users;",
+		"verify.sql": "SELECT 1 FROM users;",
+	}, files)
+
+	_, err = table.Render(Values{Vars: map[string]string{}})
+	assert.Error(t, err, "missing variable")
+
+	_, err = findTemplate("broken")
+	assert.EqualError(t, err, "template broken has no down.sql")
+
+	_, err = findTemplate("missing")
+	assert.EqualError(t, err, "unknown template missing, use one of broken, data, schema, table")
+}
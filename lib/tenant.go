@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+)
+
+// allSchemas is set by --all-schemas
+var allSchemas bool
+
+/*
+ * tenantTargets finds the tenant schemas in db, either by matching
+ * tenants.schema-pattern or by running tenants.schema-query, and returns a
+ * target for each.  Every tenant keeps its goosey table in its own schema and
+ * runs its migrations with search_path set to that schema.
+ */
+func tenantTargets(db *DB) ([]Target, error) {
+	query := viper.GetString("tenants.schema-query")
+	args := []interface{}{}
+	if query == "" {
+		pattern := viper.GetString("tenants.schema-pattern")
+		if pattern == "" {
+			return nil, fmt.Errorf(
+				"--all-schemas needs tenants.schema-pattern or tenants.schema-query")
+		}
+		query = `SELECT nspname FROM pg_namespace WHERE nspname LIKE $1 ORDER BY nspname`
+		args = append(args, pattern)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("find tenant schemas: %s", err)
+	}
+	defer rows.Close()
+
+	targets := []Target{}
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		targets = append(targets, Target{
+			Name:        schema,
+			DatabaseURL: viper.GetString("database-url"),
+			Schema:      schema,
+			Table:       viper.GetString("table"),
+			SearchPath:  schema,
+		})
+	}
+	return targets, rows.Err()
+}
+
+/*
+ * TenantDocument is the json output of status for one tenant schema.
+ */
+type TenantDocument struct {
+	Schema  string `json:"schema"`
+	Pending int    `json:"pending"`
+	State   string `json:"state"`
+}
+
+/*
+ * printTenantStatus prints how many migrations every tenant is behind and
+ * returns an error if any tenant could not be checked.
+ */
+func printTenantStatus(results []TargetResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEMA\tPENDING\tSTATE")
+
+	documents := []TenantDocument{}
+	failed := 0
+	for _, result := range results {
+		state := "up to date"
+		switch {
+		case result.Err != nil:
+			failed++
+			state = mask(result.Err.Error())
+		case result.Count > 0:
+			state = "behind"
+		}
+		documents = append(documents, TenantDocument{
+			Schema:  result.Target.Name,
+			Pending: result.Count,
+			State:   state,
+		})
+		fmt.Fprintf(w, "%s\t%d\t%s\n", result.Target.Name, result.Count, state)
+	}
+
+	if jsonOutput() {
+		if err := printJSON(documents); err != nil {
+			return err
+		}
+	} else {
+		w.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d schemas failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tenantTargetsWithoutSettings(t *testing.T) {
+	defer viper.Reset()
+
+	_, err := tenantTargets(nil)
+	assert.EqualError(t, err, "--all-schemas needs tenants.schema-pattern or tenants.schema-query")
+}
+
+var printTenantStatusTests = []struct {
+	name     string
+	results  []TargetResult
+	expected []TenantDocument
+	err      string
+}{
+	{"no tenants", []TargetResult{}, []TenantDocument{}, ""},
+	{
+		"up to date and behind",
+		[]TargetResult{
+			{Target: Target{Name: "tenant_a"}},
+			{Target: Target{Name: "tenant_b"}, Count: 3},
+		},
+		[]TenantDocument{
+			{Schema: "tenant_a", Pending: 0, State: "up to date"},
+			{Schema: "tenant_b", Pending: 3, State: "behind"},
+		},
+		"",
+	},
+	{
+		"failed",
+		[]TargetResult{
+			{Target: Target{Name: "tenant_a"}, Count: 2},
+			{Target: Target{Name: "tenant_b"}, Count: 5, Err: errors.New("password tenant-secret rejected")},
+			{Target: Target{Name: "tenant_c"}, Err: errors.New("permission denied for schema tenant_c")},
+		},
+		[]TenantDocument{
+			{Schema: "tenant_a", Pending: 2, State: "behind"},
+			{Schema: "tenant_b", Pending: 5, State: "password xxxxx rejected"},
+			{Schema: "tenant_c", Pending: 0, State: "permission denied for schema tenant_c"},
+		},
+		"2 of 3 schemas failed",
+	},
+}
+
+func Test_printTenantStatus(t *testing.T) {
+	addSecret("tenant-secret")
+	withOutput(t, outputJSON)
+
+	for _, tt := range printTenantStatusTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			out := captureStdout(t, func() { err = printTenantStatus(tt.results) })
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+
+			documents := []TenantDocument{}
+			assert.NoError(t, json.Unmarshal([]byte(out), &documents))
+			assert.Equal(t, tt.expected, documents)
+		})
+	}
+}
+
+func Test_printTenantStatusText(t *testing.T) {
+	withOutput(t, outputText)
+
+	out := captureStdout(t, func() {
+		assert.NoError(t, printTenantStatus([]TargetResult{
+			{Target: Target{Name: "tenant_a"}},
+			{Target: Target{Name: "tenant_b"}, Count: 3},
+		}))
+	})
+	assert.Equal(t, "SCHEMA    PENDING  STATE\n"+
+		"tenant_a  0        up to date\n"+
+		"tenant_b  3        behind\n", out)
+}
@@ -0,0 +1,291 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// migrationFiles are the files a migration directory may contain
+var migrationFiles = map[string]bool{
+	"up.sql":     true,
+	"down.sql":   true,
+	"verify.sql": true,
+	metadataFile: true,
+}
+
+/*
+ * Problem is something wrong with the migration repository.
+ */
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+/*
+ * Validate checks the structure and naming of the migration repository at
+ * repo without touching the database.
+ */
+func Validate(repo, directory string) ([]Problem, error) {
+	problems := []Problem{}
+
+	dirs, err := migrationDirectories(filepath.Join(repo, directory))
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Clean(directory) == "." {
+		// migrations next to the templates directory
+		for i, dir := range dirs {
+			if dir == templateDirectory {
+				dirs = append(dirs[:i], dirs[i+1:]...)
+				break
+			}
+		}
+	}
+	problems = append(problems, validateDirectories(repo, directory, dirs)...)
+
+	commits, err := commitAdditions(repo)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, validateCommits(directory, commits)...)
+	problems = append(problems, validateTemplates()...)
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+/*
+ * migrationDirectories returns the names of the directories in path, leaving
+ * out hidden ones.
+ */
+func migrationDirectories(path string) ([]string, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+func validateDirectories(repo, directory string, dirs []string) []Problem {
+	problems := []Problem{}
+	naming := namingScheme()
+	if err := naming.check(); err != nil {
+		return []Problem{{".goose.yaml", err.Error()}}
+	}
+	ordering := "timestamp"
+	if naming.has("number") {
+		ordering = "number"
+	}
+	keys := map[string]string{}
+	byName := map[string]bool{}
+	for _, dir := range dirs {
+		byName[dir] = true
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(directory, dir)
+		full := filepath.Join(repo, path)
+
+		for _, script := range []string{"up.sql", "down.sql"} {
+			info, err := os.Stat(filepath.Join(full, script))
+			if err != nil {
+				problems = append(problems, Problem{path, fmt.Sprintf("missing %s", script)})
+			} else if info.Size() == 0 {
+				problems = append(problems, Problem{path, fmt.Sprintf("%s is empty", script)})
+			}
+		}
+
+		if name, err := naming.Parse(dir); err != nil {
+			problems = append(problems, Problem{path, fmt.Sprintf("can not parse %s: %s", ordering, err)})
+		} else {
+			key := naming.key(name)
+			if other, ok := keys[key]; ok {
+				problems = append(problems, Problem{path, fmt.Sprintf("%s is also used by %s", key, other)})
+			}
+			keys[key] = path
+		}
+
+		metadata, err := loadMetadata(full)
+		if err != nil {
+			problems = append(problems, Problem{path, err.Error()})
+		}
+
+		if _, err := naming.authorFromName(dir); err != nil && metadata.Author == "" {
+			problems = append(problems, Problem{path, "can not parse author, expected {timestamp}_{first}_{last}_{message} or an author in " + metadataFile})
+		}
+		for _, dependency := range metadata.DependsOn {
+			if !byName[filepath.Base(dependency)] {
+				problems = append(problems, Problem{path, fmt.Sprintf("depends on %s which does not exist", dependency)})
+			}
+		}
+	}
+	return problems
+}
+
+/*
+ * Commit is a commit and the files it added.
+ */
+type Commit struct {
+	Hash  string
+	Files []string
+}
+
+/*
+ * commitAdditions returns every commit in the repository at path with the
+ * files it added, oldest first.
+ */
+func commitAdditions(path string) ([]Commit, error) {
+	cmd := exec.Command(
+		"git", "log", "--pretty=format:%H", "--name-status", "--diff-filter=A", "--reverse",
+	)
+	cmd.Dir = path
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log in %s: %s", path, err)
+	}
+
+	commits := []Commit{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) == 1 {
+			commits = append(commits, Commit{Hash: line})
+		} else if len(commits) > 0 {
+			last := &commits[len(commits)-1]
+			last.Files = append(last.Files, parts[len(parts)-1])
+		}
+	}
+	return commits, scanner.Err()
+}
+
+/*
+ * validateCommits checks that every commit adds files of exactly one
+ * migration, because goose only sees one migration per commit.
+ */
+func validateCommits(directory string, commits []Commit) []Problem {
+	problems := []Problem{}
+	prefix := directoryPrefix(directory)
+	snapshot := filepath.ToSlash(filepath.Clean(viper.GetString("snapshot")))
+	owned := ownedBy(prefix, commits)
+
+	for _, commit := range commits {
+		short := commit.Hash
+		if len(short) > 8 {
+			short = short[:8]
+		}
+
+		migrationsAdded := map[string]bool{}
+		for _, file := range commit.Files {
+			if !strings.HasPrefix(file, prefix) || strings.HasPrefix(file, templateDirectory+"/") || file == snapshot {
+				continue
+			}
+			parts := strings.Split(strings.TrimPrefix(file, prefix), "/")
+			if !owned(parts) {
+				continue
+			}
+			if len(parts) != 2 {
+				problems = append(problems, Problem{file, fmt.Sprintf(
+					"commit %s adds a file that is not directly in a migration directory", short)})
+				continue
+			}
+			if !migrationFiles[parts[1]] {
+				problems = append(problems, Problem{file, fmt.Sprintf(
+					"commit %s adds a file goose doesn't know", short)})
+			}
+			migrationsAdded[parts[0]] = true
+		}
+
+		if len(migrationsAdded) > 1 {
+			names := []string{}
+			for name := range migrationsAdded {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			problems = append(problems, Problem{names[0], fmt.Sprintf(
+				"commit %s adds %d migrations (%s), goose only sees one per commit",
+				short, len(names), strings.Join(names, ", "))})
+		}
+	}
+	return problems
+}
+
+/*
+ * ownedBy tells which files under prefix belong to goose.  A migration
+ * directory given as "" or "." is the root of the repository, which holds
+ * the rest of the project too, so only files in directories that some
+ * commit adds an up.sql to are checked there.
+ */
+func ownedBy(prefix string, commits []Commit) func(parts []string) bool {
+	if prefix != "" {
+		return func(parts []string) bool { return true }
+	}
+
+	migrationDirectories := map[string]bool{}
+	for _, commit := range commits {
+		if path, ok := migrationPath(prefix, commit.Files); ok {
+			migrationDirectories[filepath.ToSlash(path)] = true
+		}
+	}
+	return func(parts []string) bool {
+		return len(parts) > 1 && migrationDirectories[parts[0]]
+	}
+}
+
+/*
+ * validateTemplates renders every template in .goose.yaml and the templates
+ * directory with sample values.  Variables given with --var are left empty.
+ */
+func validateTemplates() []Problem {
+	templates, err := loadTemplates()
+	if err != nil {
+		return []Problem{{"templates", err.Error()}}
+	}
+
+	problems := []Problem{}
+	values := Values{
+		Migration: "20060102_150405_first_last_message",
+		Author:    "first last",
+		Email:     "first@example.com",
+		Directory: "20060102_150405_first_last_message",
+		Timestamp: "20060102_150405",
+		Vars:      map[string]string{},
+	}
+	for _, t := range templates {
+		path := t.Source
+		if path == ".goose.yaml" {
+			path = fmt.Sprintf("templates.%s", t.Name)
+		}
+		if err := t.check(); err != nil {
+			problems = append(problems, Problem{path, err.Error()})
+			continue
+		}
+		if _, err := t.render(values, "missingkey=zero"); err != nil {
+			problems = append(problems, Problem{path, err.Error()})
+		}
+	}
+	return problems
+}
@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var validateCommitsTests = []struct {
+	name     string
+	commits  []Commit
+	expected []Problem
+}{
+	{
+		"one migration",
+		[]Commit{{"aaaaaaaaaa", []string{
+			"migrations/20200101_120000_a_a_a/up.sql",
+			"migrations/20200101_120000_a_a_a/down.sql",
+			"migrations/20200101_120000_a_a_a/migration.yaml",
+		}}},
+		[]Problem{},
+	},
+	{
+		"two migrations",
+		[]Commit{{"aaaaaaaaaa", []string{
+			"migrations/20200101_120000_a_a_a/up.sql",
+			"migrations/20200102_120000_b_b_b/up.sql",
+		}}},
+		[]Problem{{
+			"20200101_120000_a_a_a",
+			"commit aaaaaaaa adds 2 migrations (20200101_120000_a_a_a, 20200102_120000_b_b_b), goose only sees one per commit",
+		}},
+	},
+	{
+		"unknown file",
+		[]Commit{{"aaaaaaaaaa", []string{"migrations/20200101_120000_a_a_a/notes.txt"}}},
+		[]Problem{{"migrations/20200101_120000_a_a_a/notes.txt", "commit aaaaaaaa adds a file goose doesn't know"}},
+	},
+	{
+		"loose file",
+		[]Commit{{"aaaaaaaaaa", []string{"migrations/up.sql"}}},
+		[]Problem{{"migrations/up.sql", "commit aaaaaaaa adds a file that is not directly in a migration directory"}},
+	},
+	{
+		"outside the migration directory",
+		[]Commit{{"aaaaaaaaaa", []string{"README.md"}}},
+		[]Problem{},
+	},
+}
+
+func Test_validateCommits(t *testing.T) {
+	for _, tt := range validateCommitsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, validateCommits("migrations", tt.commits))
+		})
+	}
+}
+
+func Test_validateCommitsInTheRoot(t *testing.T) {
+	viper.Set("snapshot", "schema.sql")
+	defer viper.Reset()
+
+	commits := []Commit{
+		{"aaaaaaaaaa", []string{"20200101_120000_a_a_a/up.sql", "20200101_120000_a_a_a/down.sql"}},
+		{"bbbbbbbbbb", []string{"templates/table/up.sql", "templates/table/down.sql"}},
+		{"cccccccccc", []string{"schema.sql"}},
+		{"dddddddddd", []string{".goose.yaml", "README.md", "docker-compose.yaml", "docs/setup.md"}},
+		{"eeeeeeeeee", []string{"20200101_120000_a_a_a/data/seed.csv"}},
+	}
+	assert.Equal(t, []Problem{{
+		"20200101_120000_a_a_a/data/seed.csv",
+		"commit eeeeeeee adds a file that is not directly in a migration directory",
+	}}, validateCommits(".", commits))
+}
+
+func Test_validateDirectories(t *testing.T) {
+	repo, err := ioutil.TempDir(os.TempDir(), "goosey-validate-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	write := func(dir, file, content string) {
+		path := filepath.Join(repo, "migrations", dir)
+		assert.NoError(t, os.MkdirAll(path, 0777))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(path, file), []byte(content), 0666))
+	}
+	write("20200101_120000_a_a_a", "up.sql", "select 1;")
+	write("20200101_120000_a_a_a", "down.sql", "select 1;")
+	write("20200101_120000_b_b_b", "up.sql", "select 1;")
+	write("20200101_120000_b_b_b", "down.sql", "")
+	write("nodate", "up.sql", "select 1;")
+	write("nodate", "down.sql", "select 1;")
+	write("nodate", metadataFile, "depends_on: [missing]")
+
+	dirs, err := migrationDirectories(filepath.Join(repo, "migrations"))
+	assert.NoError(t, err)
+
+	problems := validateDirectories(repo, "migrations", dirs)
+	assert.Equal(t, []Problem{
+		{"migrations/20200101_120000_b_b_b", "down.sql is empty"},
+		{"migrations/20200101_120000_b_b_b", "timestamp 20200101_120000 is also used by migrations/20200101_120000_a_a_a"},
+		{"migrations/nodate", "can not parse timestamp: invalid directory name nodate"},
+		{"migrations/nodate", "can not parse author, expected {timestamp}_{first}_{last}_{message} or an author in migration.yaml"},
+		{"migrations/nodate", "depends on missing which does not exist"},
+	}, problems)
+}
@@ -1,7 +1,13 @@
 package main
 
-import "github.com/sir-wiggles/goose/lib"
+import (
+	"os"
+
+	"github.com/sir-wiggles/goose/lib"
+)
 
 func main() {
-	lib.Execute()
+	if err := lib.Execute(); err != nil {
+		os.Exit(1)
+	}
 }